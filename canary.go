@@ -0,0 +1,209 @@
+package nodectl
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/renproject/nodectl/provider"
+	"github.com/renproject/nodectl/renvm"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+)
+
+// canaryCheckInterval is how often the canary is checked during the soak
+// period.
+const canaryCheckInterval = 30 * time.Second
+
+// canaryMemoryScript prints the memory used by the darknode process and the
+// total memory of the instance, both in KB.
+const canaryMemoryScript = `echo "rss=$(ps -o rss= -C darknode | awk '{s+=$1} END {print s+0}')"
+echo "total=$(awk '/^MemTotal:/ {print $2}' /proc/meminfo)"`
+
+// canaryCrashScript prints how many times the darknode has crashed since the
+// unix time given as `%v`. User units log into the system journal which needs
+// sudo to read. The script fails if the journal can't be read, including when
+// sudo asks for a password, instead of counting no crashes.
+const canaryCrashScript = `set -e
+journal=$(sudo -n journalctl --user-unit darknode --since @%v --no-pager --quiet)
+printf '%%s\n' "$journal" | grep -c 'Main process exited' || true`
+
+// canary updates a single darknode first and watches it for a while before
+// the version is promoted to the other darknodes.
+type canary struct {
+	name      string
+	soak      time.Duration
+	maxMemory int
+}
+
+// parseCanary parses the canary options from input arguments. An empty canary
+// is returned if no canary is given.
+func parseCanary(ctx *cli.Context) (canary, error) {
+	c := canary{
+		name:      strings.TrimSpace(ctx.String("canary")),
+		soak:      ctx.Duration("soak"),
+		maxMemory: ctx.Int("canary-max-memory"),
+	}
+	if c.name == "" {
+		return canary{}, nil
+	}
+	if err := util.NodeExistence(c.name); err != nil {
+		return canary{}, fmt.Errorf("canary [%v] doesn't exist", c.name)
+	}
+	if c.soak <= 0 {
+		return canary{}, fmt.Errorf("invalid soak period %v", c.soak)
+	}
+	if c.maxMemory <= 0 || c.maxMemory > 100 {
+		return canary{}, fmt.Errorf("invalid max memory %v%%", c.maxMemory)
+	}
+	return c, nil
+}
+
+// run updates the canary to the given version and watches it during the soak
+// period. The canary is rolled back to the previously installed version if it
+// fails. It returns the rest of the darknodes to promote the version to.
+func (c canary) run(nodes []string, version string, updateNode func(name string) error) ([]string, error) {
+	rest := make([]string, 0, len(nodes))
+	found := false
+	for _, node := range nodes {
+		if node == c.name {
+			found = true
+		} else {
+			rest = append(rest, node)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("canary [%v] is not one of the selected darknodes", c.name)
+	}
+
+	prev, err := installedVersion(c.name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read installed version of canary [%v], err = %v", c.name, err)
+	}
+	color.Green("Updating canary [%v] from %v to %v...", c.name, prev, version)
+	since := time.Now()
+	err = updateNode(c.name)
+	if err == nil {
+		err = waitHealthy(c.name, rolloutHealthTimeout)
+	}
+	if err == nil {
+		color.Green("Watching canary [%v] for %v...", c.name, c.soak)
+		err = c.watch(since)
+	}
+	if err != nil {
+		color.Red("Canary [%v] failed: %v", c.name, err)
+		c.rollback(prev)
+		if len(rest) > 0 {
+			color.Yellow("Darknodes not updated: %v", strings.Join(rest, ", "))
+		}
+		return nil, fmt.Errorf("canary [%v] failed to run version %v", c.name, version)
+	}
+
+	color.Green("- ✅ Canary [%v] is healthy after %v.", c.name, c.soak)
+	if len(rest) > 0 {
+		color.Green("Promoting version %v to %v darknodes...", version, len(rest))
+	}
+	return rest, nil
+}
+
+// watch checks the canary periodically until the end of the soak period.
+func (c canary) watch(since time.Time) error {
+	deadline := time.Now().Add(c.soak)
+	for {
+		if err := c.check(since); err != nil {
+			return err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil
+		}
+		if remaining > canaryCheckInterval {
+			remaining = canaryCheckInterval
+		}
+		time.Sleep(remaining)
+	}
+}
+
+// check makes sure the darknode service is active, it hasn't crashed since the
+// given time and its memory usage is within the bound.
+func (c canary) check(since time.Time) error {
+	if err := checkHealth(c.name); err != nil {
+		return err
+	}
+
+	username, err := provider.NodeSudoUsername(c.name)
+	if err != nil {
+		return err
+	}
+	script := fmt.Sprintf(canaryCrashScript, since.Unix())
+	result, err := util.RemoteExec(c.name, script, username, time.Minute)
+	if err != nil {
+		return fmt.Errorf("cannot read journal, err = %v", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("cannot read journal, err = %v", strings.TrimSpace(string(result.Stderr)))
+	}
+	crashes, err := strconv.Atoi(strings.TrimSpace(string(result.Stdout)))
+	if err != nil {
+		return fmt.Errorf("cannot read journal, err = %v", strings.TrimSpace(string(result.Stderr)))
+	}
+	if crashes > 0 {
+		return fmt.Errorf("darknode has crashed %v times since the update", crashes)
+	}
+
+	// Memory usage of the darknode process
+	output, err := util.RemoteOutput(c.name, canaryMemoryScript)
+	if err != nil {
+		return fmt.Errorf("cannot read memory usage, err = %v", err)
+	}
+	var rss, total int
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value, _ := strconv.Atoi(strings.TrimSpace(parts[1]))
+		switch parts[0] {
+		case "rss":
+			rss = value
+		case "total":
+			total = value
+		}
+	}
+	if total == 0 {
+		return fmt.Errorf("cannot read memory usage")
+	}
+	if rss*100 > total*c.maxMemory {
+		return fmt.Errorf("darknode is using %v%% of the memory, more than %v%%", rss*100/total, c.maxMemory)
+	}
+	return nil
+}
+
+// rollback installs the given version on the canary. Only the binary is rolled
+// back, the config stays the same.
+func (c canary) rollback(version string) {
+	if version == "" {
+		color.Red("Cannot roll back canary [%v], no previously installed version recorded.", c.name)
+		return
+	}
+	color.Yellow("Rolling back canary [%v] to %v...", c.name, version)
+	if err := update(c.name, version, false, renvm.Options{}); err != nil {
+		color.Red("Failed to roll back canary [%v]: %v", c.name, err)
+		return
+	}
+	color.Green("- ✅ Canary [%v] has been rolled back to %v.", c.name, version)
+}
+
+// installedVersion returns the darknode version recorded in the updater store
+// of the node.
+func installedVersion(name string) (string, error) {
+	output, err := util.RemoteOutput(name, getEnvScript(envInstalledVersion))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,51 @@
+package nodectl
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCanaryCrashScript(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	journal := "darknode.service: Main process exited, code=killed\nstarted\ndarknode.service: Main process exited, code=exited\n"
+	tests := []struct {
+		name    string
+		sudo    string
+		success bool
+		crashes string
+	}{
+		{"crashes", "#!/bin/sh\ncat <<'EOF'\n" + journal + "EOF\n", true, "2"},
+		{"no crashes", "#!/bin/sh\necho started\n", true, "0"},
+		{"empty journal", "#!/bin/sh\nexit 0\n", true, "0"},
+		{"password required", "#!/bin/sh\necho 'sudo: a password is required' >&2\nexit 1\n", false, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stubs := t.TempDir()
+			writeFile(t, filepath.Join(stubs, "sudo"), test.sudo)
+			if err := os.Chmod(filepath.Join(stubs, "sudo"), 0700); err != nil {
+				t.Fatal(err)
+			}
+			env := []string{"PATH=" + stubs + ":" + os.Getenv("PATH")}
+			output, err := runScript(t, env, t.TempDir(), fmt.Sprintf(canaryCrashScript, 1600000000))
+			if !test.success {
+				if err == nil {
+					t.Fatalf("expected the script to fail, output = %q", output)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("script failed, err = %v", err)
+			}
+			if got := strings.TrimSpace(output); got != test.crashes {
+				t.Errorf("crashes = %q, want %q", got, test.crashes)
+			}
+		})
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -14,7 +13,6 @@ import (
 	"time"
 
 	"github.com/fatih/color"
-	"github.com/hashicorp/go-version"
 	"github.com/joho/godotenv"
 	"github.com/renproject/nodectl/renvm"
 	"github.com/renproject/nodectl/util"
@@ -26,12 +24,15 @@ const (
 	DefaultRecoverInterval = time.Minute
 
 	KeyInstalledVersion  = "DARKNODE_INSTALLED"
+	KeyPreviousVersion   = "DARKNODE_PREVIOUS"
 	KeyConfigVersionID   = "DARKNODE_CONFIG_VERSIONID"
 	KeySnapshotVersionID = "DARKNODE_SNAPSHOT_VERSIONID"
+	KeySnapshotPinned    = "DARKNODE_SNAPSHOT_PINNED"
 
 	EnvUpdateBIN      = "UPDATE_BIN"
 	EnvUpdateConfig   = "UPDATE_CONFIG"
 	EnvUpdateRecovery = "UPDATE_RECOVERY"
+	EnvArtifactSource = "ARTIFACT_SOURCE"
 )
 
 // An auto-updater to help the Darknode keep updates in the network
@@ -73,7 +74,12 @@ func main() {
 				}
 
 				// Fetch the latest release version
-				latestVer, err := util.LatestRelease(network)
+				source, err := store.ArtifactSource()
+				if err != nil {
+					log.Printf("[ binary ] invalid artifact source, err = %v", err)
+					break
+				}
+				latestVer, err := source.LatestRelease(network)
 				if err != nil {
 					log.Printf("[ binary ] unable to fetch latest release version, err = %v", err)
 					break
@@ -99,11 +105,20 @@ func main() {
 				// Update the binary if needed
 				log.Printf("[ binary ] detect new release %v, currently installed = %v", latestVer, installedVer)
 				log.Printf("[ binary ] updating the binary...")
-				updateScript := fmt.Sprintf("curl -sL https://github.com/renproject/darknode-release/releases/download/%v/darknode > darknode && chmod +x darknode && mv darknode ~/.darknode/bin/darknode", latestVer)
+				checksum, err := source.BinaryChecksum(latestVer)
+				if err != nil {
+					log.Printf("[ binary ] unable to verify the new release, err = %v", err)
+					break
+				}
+				updateScript := fmt.Sprintf("curl -sL %v > darknode && %v && chmod +x darknode && cp -p ~/.darknode/bin/darknode ~/.darknode/bin/darknode.prev && mv darknode ~/.darknode/bin/darknode", source.BinaryURL(latestVer), util.VerifyChecksumScript("darknode", checksum))
 				if err := util.Run("bash", "-c", updateScript); err != nil {
 					log.Printf("unable to download darknode binary, err = %v", err)
 					break
 				}
+				if err := store.Set(KeyPreviousVersion, installedVer); err != nil {
+					log.Printf("unable to update the previous version in storage, err = %v", err)
+					break
+				}
 				if err := store.Set(KeyInstalledVersion, latestVer); err != nil {
 					log.Printf("unable to update the installed version in storage, err = %v", err)
 					break
@@ -143,9 +158,14 @@ func main() {
 				}
 
 				// Fetch the latest config version
-				latestVerID, err := fileVersionID(fmt.Sprintf("%v/config.json", network))
+				source, err := store.ArtifactSource()
 				if err != nil {
-					log.Printf("[ config ] unable to get config object from s3, err = %v", err)
+					log.Printf("[ config ] invalid artifact source, err = %v", err)
+					break
+				}
+				latestVerID, err := source.VersionID(network, "config.json")
+				if err != nil {
+					log.Printf("[ config ] unable to get config object from %v, err = %v", source, err)
 					break
 				}
 
@@ -154,9 +174,9 @@ func main() {
 					break
 				}
 
-				latestOptions, err := renvm.OptionTemplate(util.OptionsURL(network))
+				latestOptions, err := util.OptionTemplate(source, network)
 				if err != nil {
-					log.Printf("[ config ] unable to fetch latest options from s3, err = %v", err)
+					log.Printf("[ config ] unable to fetch latest options from %v, err = %v", source, err)
 					break
 				}
 
@@ -225,21 +245,39 @@ func main() {
 					break
 				}
 
-				// Fetch the latest snapshot version
-				latestVerID, err := fileVersionID(fmt.Sprintf("%v/latest.tar.gz", network))
+				// Fetch the latest snapshot version, unless a version is pinned
+				source, err := store.ArtifactSource()
 				if err != nil {
-					log.Printf("[recovery] unable to get snapshot object from s3, err = %v", err)
+					log.Printf("[recovery] invalid artifact source, err = %v", err)
 					break
 				}
+				latestVerID := store.Get(KeySnapshotPinned)
+				if latestVerID == "" {
+					latestVerID, err = source.VersionID(network, util.LatestSnapshot)
+					if err != nil {
+						log.Printf("[recovery] unable to get snapshot object from %v, err = %v", source, err)
+						break
+					}
+				}
 
 				if latestVerID == installedVerID {
 					break
 				}
 
 				log.Printf("[recovery] detect new snapshot, doing an recovery, old = %v, new = %v", installedVerID, latestVerID)
-				snapshotURL := util.SnapshotURL(options.Network, "")
-				script := fmt.Sprintf("cd $HOME/.darknode && rm -rf chain.wal genesis.json && mv db db-bak && curl -sSOJL %v && tar xzf latest.tar.gz && rm latest.tar.gz", snapshotURL)
-				if err := util.Run("bash", "-c", script); err != nil {
+				checksum, err := util.SnapshotChecksum(source, network, util.LatestSnapshot, latestVerID)
+				if err != nil {
+					log.Printf("[recovery] unable to verify the snapshot, err = %v", err)
+					break
+				}
+				snapshotURL, err := source.VersionURL(network, util.LatestSnapshot, latestVerID)
+				if err != nil {
+					log.Printf("[recovery] unable to find the snapshot, err = %v", err)
+					break
+				}
+				if err := util.Run("bash", "-c", util.RecoveryScript(snapshotURL, checksum)); err != nil {
+					// Stop watching, so a broken snapshot isn't downloaded again
+					// and again
 					color.Red("[recovery] recovery failed, err = %v", err)
 					return
 				}
@@ -248,9 +286,6 @@ func main() {
 					break
 				}
 
-				// Restart the service
-				RestartDarknodeService()
-
 				log.Printf("[recovery] ✅ successfully recovery using the snapshot")
 			}
 
@@ -302,17 +337,14 @@ func (store *EnvStore) Set(key, value string) error {
 	return godotenv.Write(envs, store.path)
 }
 
-func VersionCompare(ver1Str, ver2Str string) (int, error) {
-	ver1, err := version.NewVersion(ver1Str)
-	if err != nil {
-		return 0, err
-	}
+// ArtifactSource returns the artifact source selected for the darknode, which
+// is the public bucket by default.
+func (store *EnvStore) ArtifactSource() (util.ArtifactSource, error) {
+	return util.ParseArtifactSource(store.Get(EnvArtifactSource))
+}
 
-	ver2, err := version.NewVersion(ver2Str)
-	if err != nil {
-		return 0, err
-	}
-	return ver1.Compare(ver2), nil
+func VersionCompare(ver1Str, ver2Str string) (int, error) {
+	return util.CompareVersions(ver1Str, ver2Str)
 }
 
 func RestartDarknodeService() {
@@ -322,12 +354,3 @@ func RestartDarknodeService() {
 		log.Printf("unable to restart darknode service, err = %v", err)
 	}
 }
-
-func fileVersionID(key string) (string, error) {
-	response, err := http.Head(fmt.Sprintf("https://s3.ap-southeast-1.amazonaws.com/darknode.renproject.io/%v", key))
-	if err != nil {
-		return "", err
-	}
-	defer response.Body.Close()
-	return response.Header.Get("x-amz-version-id"), nil
-}
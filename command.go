@@ -2,25 +2,21 @@ package nodectl
 
 import (
 	"bufio"
-	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"sync"
-	"sync/atomic"
-	"time"
 
 	"github.com/fatih/color"
-	"github.com/google/go-github/v44/github"
 	"github.com/renproject/aw/wire"
+	"github.com/renproject/id"
 	"github.com/renproject/nodectl/provider"
 	"github.com/renproject/nodectl/renvm"
 	"github.com/renproject/nodectl/util"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
 )
 
 // Commands for different actions to darknodes.
@@ -76,6 +72,10 @@ func updateServiceStatus(ctx *cli.Context, cmd string) error {
 // provided to only show Darknodes have the tags
 func listAllNodes(ctx *cli.Context) error {
 	tags := ctx.String("tags")
+	format, err := parseOutputFormat(ctx.String("output"))
+	if err != nil {
+		return err
+	}
 	nodesNames, err := util.GetNodesByTags(tags)
 	if err != nil {
 		return err
@@ -83,9 +83,7 @@ func listAllNodes(ctx *cli.Context) error {
 
 	// Fetch darknodes details in parallel
 	wg := new(sync.WaitGroup)
-	infos := make([]NodeInfo, len(nodesNames))
-	errs := make([]error, len(nodesNames))
-	var errNum int64
+	infos := make(NodeInfos, len(nodesNames))
 	for i := range nodesNames {
 		wg.Add(1)
 
@@ -93,52 +91,45 @@ func listAllNodes(ctx *cli.Context) error {
 			defer wg.Done()
 			info, err := GetNodeInfo(nodesNames[i])
 			if err != nil {
-				errs[i] = err
-				atomic.AddInt64(&errNum, 1)
-				return
+				info = NodeInfo{
+					Name:  nodesNames[i],
+					Error: err.Error(),
+				}
 			}
 			infos[i] = info
 		}(i)
 	}
 	wg.Wait()
 
-	// Display the darknodes info in a formatted table.
-	if errNum == int64(len(nodesNames)) {
-		color.Red("Fail to fetch nodes info.")
-		errMessages := make([]string, 0, len(errs))
-		for i, err := range errs {
-			if err != nil {
-				errMessages = append(errMessages, fmt.Sprintf("%v %v", nodesNames[i], err.Error()))
-			}
-		}
-		color.Red(strings.Join(errMessages, "\n"))
+	if format != OutputTable {
+		return printOutput(format, infos)
 	}
 
-	fmt.Printf("%-20s | %-45s | %-15s | %-8s | %-15s\n", "name", "ethereum address", "ip", "provider", "tags")
+	// Display the darknodes info in a formatted table and the errors of the
+	// nodes which we cannot get the info after it.
+	rows := make([][]string, 0, len(infos))
 	for _, info := range infos {
-		if info.Name != "" {
-			fmt.Printf("%v", info.String())
+		if info.Error == "" {
+			rows = append(rows, info.Row())
+		}
+	}
+	header := infos.Header()
+	printTable(header[:len(header)-1], rows)
+	for _, info := range infos {
+		if info.Error != "" {
+			color.Red("%v %v", info.Name, info.Error)
 		}
 	}
-
-	// // Print error of nodes which we cannot get the info
-	// // TODO : Might be good to print error messages when having a `-v` or `-debug` flag
-	// if errNum > 0 {
-	// 	for i, err := range errs {
-	// 		if err != nil {
-	// 			color.Red("%v %v", nodesNames[i], err.Error())
-	// 		}
-	// 	}
-	// }
 	return nil
 }
 
 type NodeInfo struct {
-	Name     string
-	IP       string
-	EthAddr  string
-	Provider string
-	Tags     string
+	Name     string `json:"name"`
+	IP       string `json:"ip"`
+	EthAddr  string `json:"ethereumAddress"`
+	Provider string `json:"provider"`
+	Tags     string `json:"tags"`
+	Error    string `json:"error,omitempty"`
 }
 
 func (info NodeInfo) String() string {
@@ -151,6 +142,99 @@ func (info NodeInfo) String() string {
 	)
 }
 
+// Row returns the fields of the node info in the same order as the header.
+func (info NodeInfo) Row() []string {
+	return []string{info.Name, info.EthAddr, info.IP, info.Provider, info.Tags}
+}
+
+// NodeInfos is a list of NodeInfo which implements the `Tabular` interface.
+type NodeInfos []NodeInfo
+
+// Header implements the `Tabular` interface
+func (infos NodeInfos) Header() []string {
+	return []string{"name", "ethereum address", "ip", "provider", "tags", "error"}
+}
+
+// Rows implements the `Tabular` interface
+func (infos NodeInfos) Rows() [][]string {
+	rows := make([][]string, len(infos))
+	for i, info := range infos {
+		rows[i] = append(info.Row(), info.Error)
+	}
+	return rows
+}
+
+// AddressInfo is the signed address of a node.
+type AddressInfo struct {
+	Name      string        `json:"name"`
+	Address   string        `json:"address"`
+	Protocol  wire.Protocol `json:"protocol"`
+	Value     string        `json:"value"`
+	Nonce     uint64        `json:"nonce"`
+	Signature id.Signature  `json:"signature"`
+}
+
+// Header implements the `Tabular` interface
+func (info AddressInfo) Header() []string {
+	return []string{"name", "protocol", "value", "nonce", "signature"}
+}
+
+// Rows implements the `Tabular` interface
+func (info AddressInfo) Rows() [][]string {
+	return [][]string{{
+		info.Name,
+		info.Protocol.String(),
+		info.Value,
+		fmt.Sprintf("%v", info.Nonce),
+		info.Signature.String(),
+	}}
+}
+
+// showAddress prints the signed address of the node. Without an explicit
+// `--output` flag the raw peer is printed as json.
+func showAddress(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	format, err := parseOutputFormat(ctx.String("output"))
+	if err != nil {
+		return err
+	}
+	if err := util.NodeExistence(name); err != nil {
+		return err
+	}
+	ip, err := util.NodeIP(name)
+	if err != nil {
+		return err
+	}
+	opts, err := util.NodeOptions(name)
+	if err != nil {
+		return err
+	}
+	for _, peer := range opts.Peers {
+		if strings.HasPrefix(peer.Value, ip) {
+			// Keep printing the raw peer by default so existing consumers of
+			// the command are not affected.
+			if !ctx.IsSet("output") {
+				data, err := json.MarshalIndent(peer, "", "    ")
+				if err != nil {
+					return err
+				}
+				color.Green("%s", data)
+				return nil
+			}
+			info := AddressInfo{
+				Name:      name,
+				Address:   peer.String(),
+				Protocol:  peer.Protocol,
+				Value:     peer.Value,
+				Nonce:     peer.Nonce,
+				Signature: peer.Signature,
+			}
+			return printOutput(format, info)
+		}
+	}
+	return fmt.Errorf("cannot fetch darknode address")
+}
+
 func GetNodeInfo(name string) (NodeInfo, error) {
 	if err := util.NodeExistence(name); err != nil {
 		return NodeInfo{}, err
@@ -169,12 +253,10 @@ func GetNodeInfo(name string) (NodeInfo, error) {
 	if err != nil {
 		return NodeInfo{}, err
 	}
-	tagFile := filepath.Join(util.NodePath(name), "tags.out")
-	tagsBytes, err := ioutil.ReadFile(tagFile)
+	tags, err := util.NodeTags(name)
 	if err != nil {
 		return NodeInfo{}, err
 	}
-	tags := strings.TrimSpace(string(tagsBytes))
 
 	return NodeInfo{
 		Name:     name,
@@ -191,6 +273,24 @@ func UpdateDarknode(ctx *cli.Context) error {
 	dep := ctx.Bool("dep")
 	config := ctx.Bool("config")
 	version := strings.TrimSpace(ctx.String("version"))
+	strategy := ctx.String("strategy")
+	if strategy != StrategyAll && strategy != StrategyRolling {
+		return fmt.Errorf("unknown strategy [%v], please use either %v or %v", strategy, StrategyAll, StrategyRolling)
+	}
+	var r rollout
+	if strategy == StrategyRolling {
+		var err error
+		if r, err = parseRollout(ctx); err != nil {
+			return err
+		}
+	}
+	c, err := parseCanary(ctx)
+	if err != nil {
+		return err
+	}
+	if name == "" && tags == "" {
+		name = c.name
+	}
 
 	// Parse nodes from the name/tags
 	nodes, err := util.ParseNodesFromNameAndTags(name, tags)
@@ -203,29 +303,70 @@ func UpdateDarknode(ctx *cli.Context) error {
 	}
 	network := options.Network
 
+	// Releases are looked up from the artifact source of the first darknode,
+	// the same as the network
+	source, err := util.NodeArtifactSource(nodes[0])
+	if err != nil {
+		return err
+	}
+
 	// Use latest version if user doesn't provide a version number
-	if version != "" {
-		if err := validateVersion(version); err != nil {
-			return err
-		}
-	} else {
-		version, err = util.LatestRelease(network)
+	if version == "" {
+		version, err = source.LatestRelease(network)
 		if err != nil {
 			return err
 		}
 	}
 
+	// Refuse to update if the release can't be found or verified
+	if _, err := source.BinaryChecksum(version); err != nil {
+		return err
+	}
+
+	// Make sure users know the risk before downgrading darknodes
+	downgraded, installed, err := downgradedNodes(nodes, version)
+	if err != nil {
+		return err
+	}
+	if len(downgraded) > 0 {
+		for i := range downgraded {
+			color.Yellow("- [%v] has version %v installed, which is newer than %v", downgraded[i], installed[i], version)
+		}
+		color.Yellow(downgradeWarning)
+		if !ctx.Bool("downgrade") {
+			return fmt.Errorf("refusing to downgrade %v darknodes to %v, use --downgrade if you're sure", len(downgraded), version)
+		}
+	}
+
 	// Get the config template if we need to update the config
 	var newOptions renvm.Options
 	if config {
-		optionsURL := util.OptionsURL(options.Network)
-		newOptions, err = renvm.OptionTemplate(optionsURL)
+		newOptions, err = util.OptionTemplate(source, options.Network)
 		if err != nil {
 			return fmt.Errorf("fetching latest options template: %v", err)
 		}
 	}
 
 	// Updating darknodes
+	updateNode := func(name string) error {
+		return update(name, version, dep, newOptions)
+	}
+	if c.name != "" {
+		if nodes, err = c.run(nodes, version, updateNode); err != nil {
+			return err
+		}
+		if len(nodes) == 0 {
+			return nil
+		}
+	}
+	if strategy == StrategyRolling {
+		return r.run(nodes, updateNode)
+	}
+	return updateAll(nodes, updateNode)
+}
+
+// updateAll updates all the darknodes at the same time.
+func updateAll(nodes []string, updateNode func(name string) error) error {
 	color.Green("Updating darknodes...")
 	errs := make([]error, len(nodes))
 	wg := new(sync.WaitGroup)
@@ -234,7 +375,7 @@ func UpdateDarknode(ctx *cli.Context) error {
 		go func(i int) {
 			defer wg.Done()
 
-			errs[i] = update(nodes[i], version, dep, newOptions)
+			errs[i] = updateNode(nodes[i])
 			if errs[i] == nil {
 				color.Green("- ✅ [%v] has been updated.", nodes[i])
 			}
@@ -245,15 +386,273 @@ func UpdateDarknode(ctx *cli.Context) error {
 	return util.HandleErrs(errs)
 }
 
+// ResizeDarknode changes the instance type of the darknodes without replacing
+// the instances. Nodes are resized one by one to avoid taking down all of them
+// at the same time.
+func ResizeDarknode(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	tags := ctx.String("tags")
+
+	// Parse nodes from the name/tags
+	nodes, err := util.ParseNodesFromNameAndTags(name, tags)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(nodes))
+	for i, node := range nodes {
+		errs[i] = func() error {
+			p, err := provider.ParseNodeProvider(node)
+			if err != nil {
+				return err
+			}
+			size, err := resizeTarget(ctx, p.Name())
+			if err != nil {
+				return err
+			}
+			color.Green("- Resizing [%v] to %v", node, size)
+			if err := p.Resize(node, size); err != nil {
+				return err
+			}
+			return util.UpdateNodeMetadata(node, func(meta *util.NodeMetadata) {
+				meta.Instance = size
+			})
+		}()
+		if errs[i] == nil {
+			color.Green("- ✅ [%v] has been resized.", node)
+		} else {
+			color.Red("failed to resize [%v]: %v", node, errs[i])
+		}
+	}
+	return util.HandleErrs(errs)
+}
+
+// resizeTarget returns the new instance type from the flag of given provider.
+func resizeTarget(ctx *cli.Context, name string) (string, error) {
+	var flag string
+	switch name {
+	case provider.NameAws:
+		flag = AwsInstanceFlag.Name
+	case provider.NameDo:
+		flag = DoSizeFlag.Name
+	case provider.NameGcp:
+		flag = GcpMachineFlag.Name
+	default:
+		return "", fmt.Errorf("resizing is not supported by provider %v", name)
+	}
+	if !ctx.IsSet(flag) {
+		return "", fmt.Errorf("please specify the new size with --%v", flag)
+	}
+	return ctx.String(flag), nil
+}
+
+// GrowDisk expands the disk of the darknodes to the given size. The disk and
+// filesystem are grown online, so the darknodes keep running.
+func GrowDisk(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	tags := ctx.String("tags")
+	size := ctx.Int("disk-size")
+	if size <= 0 {
+		return fmt.Errorf("please specify the new disk size with --%v", DiskSizeFlag.Name)
+	}
+
+	// Parse nodes from the name/tags
+	nodes, err := util.ParseNodesFromNameAndTags(name, tags)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(nodes))
+	for i, node := range nodes {
+		errs[i] = func() error {
+			p, err := provider.ParseNodeProvider(node)
+			if err != nil {
+				return err
+			}
+			color.Green("- Growing disk of [%v] to %vGB", node, size)
+			return p.GrowDisk(node, size)
+		}()
+		if errs[i] == nil {
+			color.Green("- ✅ Disk of [%v] has been grown.", node)
+		} else {
+			color.Red("failed to grow disk of [%v]: %v", node, errs[i])
+		}
+	}
+	return util.HandleErrs(errs)
+}
+
+// MigrateDarknode writes or reconciles the metadata file of the darknodes
+// using their terraform state. All darknodes are migrated if neither name nor
+// tags is given.
+func MigrateDarknode(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	tags := ctx.String("tags")
+
+	// Parse nodes from the name/tags
+	nodes, err := parseNodesOrAll(name, tags)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(nodes))
+	wg := new(sync.WaitGroup)
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			_, errs[i] = provider.ReconcileMetadata(nodes[i])
+			if errs[i] == nil {
+				color.Green("- ✅ [%v] has been migrated.", nodes[i])
+			} else {
+				color.Red("failed to migrate [%v]: %v", nodes[i], errs[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+	return util.HandleErrs(errs)
+}
+
+// EncryptKeys encrypts the config of the darknodes with the keystore
+// passphrase. Nodes are processed one by one, so the passphrase is only
+// prompted once.
+func EncryptKeys(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	tags := ctx.String("tags")
+
+	// Parse nodes from the name/tags
+	nodes, err := parseNodesOrAll(name, tags)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, 0, len(nodes))
+	for _, node := range nodes {
+		if util.NodeConfigEncrypted(node) {
+			color.Yellow("- [%v] is already encrypted.", node)
+			continue
+		}
+		err := func() error {
+			options, err := util.NodeOptions(node)
+			if err != nil {
+				return err
+			}
+			return util.EncryptNodeOptions(node, options)
+		}()
+		if err != nil {
+			color.Red("failed to encrypt [%v]: %v", node, err)
+			errs = append(errs, err)
+			continue
+		}
+		color.Green("- ✅ [%v] has been encrypted.", node)
+	}
+
+	// Backups of the config are written in plaintext by older versions, they
+	// are also kept after the darknode is destroyed.
+	backups := nodes
+	if name == "" && tags == "" {
+		if backups, err = util.PlaintextConfigBackups(); err != nil {
+			return err
+		}
+	}
+	for _, node := range backups {
+		if err := util.EncryptConfigBackup(node); err != nil {
+			color.Red("failed to encrypt backup of [%v]: %v", node, err)
+			errs = append(errs, err)
+		}
+	}
+	return util.HandleErrs(errs)
+}
+
+// DecryptKeys converts the encrypted config of the darknodes back to
+// plaintext.
+func DecryptKeys(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	tags := ctx.String("tags")
+
+	// Parse nodes from the name/tags
+	nodes, err := parseNodesOrAll(name, tags)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, 0, len(nodes))
+	for _, node := range nodes {
+		if !util.NodeConfigEncrypted(node) {
+			color.Yellow("- [%v] is not encrypted.", node)
+			continue
+		}
+		if err := util.DecryptNodeConfig(node); err != nil {
+			color.Red("failed to decrypt [%v]: %v", node, err)
+			errs = append(errs, err)
+			continue
+		}
+		color.Green("- ✅ [%v] has been decrypted.", node)
+	}
+	return util.HandleErrs(errs)
+}
+
+// parseNodesOrAll returns the darknodes with given name or tags, or all the
+// darknodes if neither of them is given.
+func parseNodesOrAll(name, tags string) ([]string, error) {
+	if name == "" && tags == "" {
+		return util.GetNodesByTags("")
+	}
+	return util.ParseNodesFromNameAndTags(name, tags)
+}
+
+// RekeyDarknode replaces the pinned host key of the darknode with the one
+// currently presented by the instance.
+func RekeyDarknode(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	force := ctx.Bool("force")
+	if err := util.NodeExistence(name); err != nil {
+		return err
+	}
+
+	key, err := util.FetchHostKey(name)
+	if err != nil {
+		return err
+	}
+	color.Yellow("The host key of [%v] is now %v", name, ssh.FingerprintSHA256(key))
+	if data, err := ioutil.ReadFile(util.KnownHostsPath(name)); err == nil {
+		if _, _, old, _, _, err := ssh.ParseKnownHosts(data); err == nil {
+			color.Yellow("The recorded host key is %v", ssh.FingerprintSHA256(old))
+		}
+	}
+
+	// Confirmation prompt if force prompt is not present
+	if !force {
+		color.Yellow("Only continue if you are sure the host key has been changed legitimately, i.e. the instance has been rebuilt.")
+		fmt.Println("Do you want to trust the new host key? (y/N)")
+		reader := bufio.NewReader(os.Stdin)
+		text, _ := reader.ReadString('\n')
+		input := strings.ToLower(strings.TrimSpace(text))
+		if input != "yes" && input != "y" {
+			return nil
+		}
+	}
+
+	if err := util.PinHostKey(name, key); err != nil {
+		return err
+	}
+	color.Green("Host key of [%v] has been updated.", name)
+	return nil
+}
+
 func RecoverDarknode(ctx *cli.Context) error {
 	name := ctx.Args().First()
 	tags := ctx.String("tags")
 	force := ctx.Bool("force")
 	snapshot := ctx.String("snapshot")
+	versionID := strings.TrimSpace(ctx.String("snapshot-version"))
+	if snapshot == "" {
+		snapshot = util.LatestSnapshot
+	}
 
 	// Confirmation prompt if force prompt is not present
 	if !force {
-		color.Yellow("This will clear your darknode database and reset everything to the latest snapshot")
+		color.Yellow("This will clear your darknode database and reset everything to the snapshot")
 		color.Yellow("Are you sure you want to recover? (y/N)")
 		reader := bufio.NewReader(os.Stdin)
 		text, _ := reader.ReadString('\n')
@@ -269,50 +668,66 @@ func RecoverDarknode(ctx *cli.Context) error {
 		return err
 	}
 
+	errs := make([]error, len(nodes))
 	wg := new(sync.WaitGroup)
 	for i := range nodes {
 		wg.Add(1)
-		node := nodes[i]
-
-		go func() {
+		go func(i int) {
 			defer wg.Done()
 
-			options, err := util.NodeOptions(node)
+			options, err := util.NodeOptions(nodes[i])
 			if err != nil {
-				color.Red("cannot read darknode %v config file, err = %v", node, err)
+				errs[i] = fmt.Errorf("cannot read darknode %v config file, err = %v", nodes[i], err)
 				return
 			}
-
-			// Stop the darknode service
-			color.Green("[%v] stop darknode", node)
-			stopService := "systemctl --user stop darknode"
-			if err := util.RemoteRun(name, stopService, "darknode"); err != nil {
-				color.Red("failed to stop darknode service, err = %v", err)
+			source, err := util.NodeArtifactSource(nodes[i])
+			if err != nil {
+				errs[i] = fmt.Errorf("cannot read artifact source of [%v], err = %v", nodes[i], err)
 				return
 			}
 
-			// Download the snapshot and replace the current database
-			snapshotURL := util.SnapshotURL(options.Network, snapshot)
-			script := fmt.Sprintf("cd .darknode && rm -rf db chain.wal genesis.json && curl -sSOJL %v && tar xzf latest.tar.gz && rm latest.tar.gz", snapshotURL)
-			if err := util.RemoteRun(name, script, "darknode"); err != nil {
-				color.Red("failed to fetch snapshot file, err = %v", err)
+			// Download and verify the snapshot, then swap it with the current
+			// database while the darknode is stopped
+			color.Green("[%v] recovering from snapshot", nodes[i])
+			checksum, err := util.SnapshotChecksum(source, options.Network, snapshot, versionID)
+			if err != nil {
+				errs[i] = fmt.Errorf("cannot verify snapshot for [%v], err = %v", nodes[i], err)
 				return
 			}
-
-			// Restart the darknode
-			restartService := "systemctl --user restart darknode"
-			if err := util.RemoteRun(name, restartService, "darknode"); err != nil {
-				color.Red("failed to restart darknode service, err = %v", err)
+			snapshotURL, err := source.VersionURL(options.Network, snapshot, versionID)
+			if err != nil {
+				errs[i] = fmt.Errorf("cannot find snapshot for [%v], err = %v", nodes[i], err)
 				return
 			}
-			color.Green("[%v] is recovered", node)
-		}()
+			if err := util.RemoteRun(nodes[i], util.RecoveryScript(snapshotURL, checksum), "darknode"); err != nil {
+				errs[i] = fmt.Errorf("cannot recover [%v], err = %v", nodes[i], err)
+				return
+			}
+			color.Green("[%v] is recovered", nodes[i])
+		}(i)
 	}
 	wg.Wait()
-	return nil
+	return util.HandleErrs(errs)
 }
 
 func update(name, ver string, dep bool, template renvm.Options) error {
+	// The binary is only installed if it matches the checksum of the release
+	source, err := util.NodeArtifactSource(name)
+	if err != nil {
+		return err
+	}
+	checksum, err := source.BinaryChecksum(ver)
+	if err != nil {
+		return err
+	}
+
+	// Auto-update is paused if it's a downgrade, so the updater doesn't
+	// upgrade it again
+	installed, err := installedVersion(name)
+	if err != nil {
+		return fmt.Errorf("cannot read installed version, err = %v", err)
+	}
+
 	// Update the dependency for darknode if needed
 	if dep {
 		color.Green("- Updating [%v] dependency", name)
@@ -334,42 +749,19 @@ func update(name, ver string, dep bool, template renvm.Options) error {
 		if err != nil {
 			return err
 		}
-		configScript = fmt.Sprintf(`&& echo '%v' > ~/.darknode/config.json`, string(newOptionsAsBytes))
+		configScript = fmt.Sprintf(`echo '%v' > ~/.darknode/config.json`, string(newOptionsAsBytes))
 	}
 
 	// Update binary and config in the remote instance
 	username := util.NodeInstanceUser(name)
-	url := fmt.Sprintf("https://www.github.com/renproject/darknode-release/releases/download/%v", ver)
-	script := fmt.Sprintf(`curl -sL %v/darknode > ~/.darknode/bin/darknode-new && 
-mv ~/.darknode/bin/darknode-new ~/.darknode/bin/darknode &&
-chmod +x ~/.darknode/bin/darknode %v && systemctl --user restart darknode`, url, configScript)
-
-	return util.RemoteRun(name, script, username)
-}
-
-func validateVersion(version string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	script := fmt.Sprintf("%v\n%v\nsystemctl --user restart darknode", installScript(source.BinaryURL(ver), ver, checksum, isDowngrade(ver, installed)), configScript)
 
-	client := github.NewClient(nil)
-	_, response, err := client.Repositories.GetReleaseByTag(ctx, "renproject", "darknode-release", version)
-	if err != nil {
+	if err := util.RemoteRun(name, script, username); err != nil {
 		return err
 	}
-
-	// Check the status code of the response
-	switch response.StatusCode {
-	case http.StatusOK:
-		return nil
-	case http.StatusNotFound:
-		return fmt.Errorf("cannot find release [%v] on github", version)
-	default:
-		data, err := ioutil.ReadAll(response.Body)
-		if err != nil {
-			return err
-		}
-		return fmt.Errorf("cannot connect to github, code = %v, err = %v", response.StatusCode, string(data))
-	}
+	return util.UpdateNodeMetadata(name, func(meta *util.NodeMetadata) {
+		meta.Version = ver
+	})
 }
 
 func updateDependency(name string) error {
@@ -409,8 +801,7 @@ func updateConfig(name string, template renvm.Options) (renvm.Options, error) {
 	}
 
 	// Update our local version of the config file
-	path := filepath.Join(util.NodePath(name), "config.json")
-	if err := renvm.OptionsToFile(newOptions, path); err != nil {
+	if err := util.WriteNodeOptions(name, newOptions); err != nil {
 		return renvm.Options{}, fmt.Errorf("update local config : %v", err)
 	}
 	return newOptions, nil
@@ -0,0 +1,339 @@
+package nodectl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pkg/sftp"
+	"github.com/renproject/nodectl/provider"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+)
+
+// ErrInvalidCopyArgs is returned when the source and destination of the copy
+// command are not one local path and one remote path.
+var ErrInvalidCopyArgs = errors.New("please provide one local path and one remote path in the form of [name]:path")
+
+// CopyFiles copies files between the local machine and the darknodes through
+// SFTP. Remote paths are in the form of `name:path`, or `:path` when the
+// darknodes are selected by tags.
+func CopyFiles(ctx *cli.Context) error {
+	tags := ctx.String("tags")
+	recursive := ctx.Bool("recursive")
+	user := ctx.String("user")
+	if user != "darknode" && user != "sudo" {
+		return fmt.Errorf("unknown user [%v], please use either darknode or sudo", user)
+	}
+	if ctx.Args().Len() != 2 {
+		return ErrInvalidCopyArgs
+	}
+	src, dst := ctx.Args().Get(0), ctx.Args().Get(1)
+	srcName, srcPath, srcRemote := parseRemotePath(src)
+	dstName, dstPath, dstRemote := parseRemotePath(dst)
+	if srcRemote == dstRemote {
+		return ErrInvalidCopyArgs
+	}
+	upload := dstRemote
+	name := srcName
+	if upload {
+		name = dstName
+	}
+
+	// Parse the names of the darknode we want to operate
+	nodes, err := util.ParseNodesFromNameAndTags(name, tags)
+	if err != nil {
+		return err
+	}
+	if !upload && len(nodes) > 1 {
+		// Files from different nodes go to their own sub-directories
+		if err := os.MkdirAll(dstPath, 0700); err != nil {
+			return err
+		}
+	}
+
+	mu := new(sync.Mutex)
+	errs := make([]error, len(nodes))
+	wg := new(sync.WaitGroup)
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			c := copier{
+				node:      nodes[i],
+				recursive: recursive,
+				progress:  len(nodes) == 1,
+				mu:        mu,
+			}
+			if upload {
+				errs[i] = c.run(user, func(client *sftp.Client) error {
+					return c.upload(client, srcPath, dstPath)
+				})
+			} else {
+				target := dstPath
+				if len(nodes) > 1 {
+					target = filepath.Join(dstPath, nodes[i])
+					if errs[i] = os.MkdirAll(target, 0700); errs[i] != nil {
+						return
+					}
+				}
+				errs[i] = c.run(user, func(client *sftp.Client) error {
+					return c.download(client, srcPath, target)
+				})
+			}
+			if errs[i] == nil {
+				color.Green("- ✅ [%v] copied %v files (%v).", nodes[i], c.files, formatBytes(c.bytes))
+			} else {
+				color.Red("failed to copy files of [%v]: %v", nodes[i], errs[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+	return util.HandleErrs(errs)
+}
+
+// parseRemotePath parses the `name:path` form of a remote path. Remote paths
+// relative to the home directory can start with `~/`.
+func parseRemotePath(arg string) (string, string, bool) {
+	index := strings.Index(arg, ":")
+	if index < 0 || strings.ContainsAny(arg[:index], "/\\") {
+		return "", arg, false
+	}
+	remotePath := arg[index+1:]
+	if remotePath == "~" {
+		remotePath = "."
+	}
+	remotePath = strings.TrimPrefix(remotePath, "~/")
+	if remotePath == "" {
+		remotePath = "."
+	}
+	return arg[:index], remotePath, true
+}
+
+// copier copies files between the local machine and a single node.
+type copier struct {
+	node      string
+	recursive bool
+	progress  bool
+	mu        *sync.Mutex
+
+	files int
+	bytes int64
+}
+
+// run opens a sftp session to the node as the given user.
+func (c *copier) run(user string, f func(client *sftp.Client) error) error {
+	username := util.NodeInstanceUser(c.node)
+	if user == "sudo" {
+		var err error
+		if username, err = provider.NodeSudoUsername(c.node); err != nil {
+			return err
+		}
+	}
+	conn, err := util.Dial(c.node, username)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return fmt.Errorf("cannot start sftp session, err = %v", err)
+	}
+	defer client.Close()
+	return f(client)
+}
+
+// upload copies the local file or directory to the remote path. If the remote
+// path is an existing directory, the file is copied into it.
+func (c *copier) upload(client *sftp.Client, src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if remote, err := client.Stat(dst); err == nil && remote.IsDir() {
+		dst = path.Join(dst, filepath.Base(src))
+	}
+	if !info.IsDir() {
+		return c.uploadFile(client, src, dst, info)
+	}
+	if !c.recursive {
+		return fmt.Errorf("%v is a directory, please use --recursive", src)
+	}
+
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join(dst, filepath.ToSlash(rel))
+		if info.IsDir() {
+			if err := client.MkdirAll(target); err != nil {
+				return fmt.Errorf("cannot create directory %v, err = %v", target, err)
+			}
+			return client.Chmod(target, info.Mode().Perm())
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return c.uploadFile(client, p, target, info)
+	})
+}
+
+func (c *copier) uploadFile(client *sftp.Client, src, dst string, info os.FileInfo) error {
+	local, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+	remote, err := client.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("cannot create %v, err = %v", dst, err)
+	}
+	defer remote.Close()
+
+	if err := c.copy(remote, local, dst, info.Size()); err != nil {
+		return err
+	}
+	return client.Chmod(dst, info.Mode().Perm())
+}
+
+// download copies the remote file or directory to the local path. If the local
+// path is an existing directory, the file is copied into it.
+func (c *copier) download(client *sftp.Client, src, dst string) error {
+	info, err := client.Stat(src)
+	if err != nil {
+		return fmt.Errorf("cannot read %v, err = %v", src, err)
+	}
+	if local, err := os.Stat(dst); err == nil && local.IsDir() {
+		dst = filepath.Join(dst, path.Base(src))
+	}
+	if !info.IsDir() {
+		return c.downloadFile(client, src, dst, info)
+	}
+	if !c.recursive {
+		return fmt.Errorf("%v is a directory, please use --recursive", src)
+	}
+
+	walker := client.Walk(src)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), src), "/")
+		target := filepath.Join(dst, filepath.FromSlash(rel))
+		info := walker.Stat()
+		if info.IsDir() {
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if err := c.downloadFile(client, walker.Path(), target, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *copier) downloadFile(client *sftp.Client, src, dst string, info os.FileInfo) error {
+	remote, err := client.Open(src)
+	if err != nil {
+		return fmt.Errorf("cannot open %v, err = %v", src, err)
+	}
+	defer remote.Close()
+	local, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	return c.copy(local, remote, dst, info.Size())
+}
+
+// copy copies the file content and displays the progress.
+func (c *copier) copy(dst io.Writer, src io.Reader, name string, size int64) error {
+	w := &progressWriter{
+		w:     dst,
+		label: fmt.Sprintf("[%v] %v", c.node, name),
+		size:  size,
+		show:  c.progress,
+	}
+	n, err := io.Copy(w, src)
+	w.done()
+	if err != nil {
+		return fmt.Errorf("cannot copy %v, err = %v", name, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files++
+	c.bytes += n
+	if !c.progress {
+		fmt.Printf("[%v] %v (%v)\n", c.node, name, formatBytes(n))
+	}
+	return nil
+}
+
+// progressWriter prints the progress of copying a file on a single line.
+type progressWriter struct {
+	w       io.Writer
+	label   string
+	size    int64
+	show    bool
+	written int64
+	last    time.Time
+}
+
+// Write implements the `io.Writer` interface
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.written += int64(n)
+	if pw.show && time.Since(pw.last) > 200*time.Millisecond {
+		pw.last = time.Now()
+		pw.print()
+	}
+	return n, err
+}
+
+func (pw *progressWriter) done() {
+	if pw.show {
+		pw.print()
+		fmt.Println()
+	}
+}
+
+func (pw *progressWriter) print() {
+	percent := 100
+	if pw.size > 0 {
+		percent = int(pw.written * 100 / pw.size)
+	}
+	fmt.Printf("\r%v %v/%v (%v%%)", pw.label, formatBytes(pw.written), formatBytes(pw.size), percent)
+}
+
+// formatBytes returns the human-readable size of the given number of bytes.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%vB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
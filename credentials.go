@@ -0,0 +1,120 @@
+package nodectl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/renproject/nodectl/provider"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+)
+
+// CredentialProfiles is a list of credential profiles which implements the
+// `Tabular` interface.
+type CredentialProfiles []util.CredentialProfile
+
+// Header implements the `Tabular` interface
+func (profiles CredentialProfiles) Header() []string {
+	return []string{"name", "provider"}
+}
+
+// Rows implements the `Tabular` interface
+func (profiles CredentialProfiles) Rows() [][]string {
+	rows := make([][]string, len(profiles))
+	for i, profile := range profiles {
+		rows[i] = []string{profile.Name, profile.Provider}
+	}
+	return rows
+}
+
+// AddCredentials stores the credentials of the cloud provider as an encrypted
+// profile. The credentials are resolved the same way as deploying a darknode.
+func AddCredentials(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	if name == "" {
+		return errors.New("profile name cannot be empty")
+	}
+	if _, err := os.Stat(util.CredentialProfilePath(name)); err == nil {
+		return fmt.Errorf("credential profile [%v] already exists", name)
+	}
+
+	providerName := ""
+	for _, p := range []string{provider.NameAws, provider.NameDo, provider.NameGcp} {
+		if ctx.Bool(p) {
+			providerName = p
+		}
+	}
+	if providerName == "" {
+		return errors.New("please specify the cloud provider with --aws, --do or --gcp")
+	}
+	creds, err := provider.ResolveCredentials(ctx, providerName)
+	if err != nil {
+		return err
+	}
+
+	profile := util.CredentialProfile{
+		Name:        name,
+		Provider:    providerName,
+		Credentials: creds,
+	}
+	if err := util.WriteCredentialProfile(profile); err != nil {
+		return err
+	}
+	color.Green("Credential profile [%v] has been added.", name)
+	return nil
+}
+
+// ListCredentials prints the names and providers of the stored credential
+// profiles.
+func ListCredentials(ctx *cli.Context) error {
+	format, err := parseOutputFormat(ctx.String("output"))
+	if err != nil {
+		return err
+	}
+	profiles, err := util.ListCredentialProfiles()
+	if err != nil {
+		return err
+	}
+	return printOutput(format, CredentialProfiles(profiles))
+}
+
+// RemoveCredentials removes the stored credential profile.
+func RemoveCredentials(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	if err := util.RemoveCredentialProfile(name); err != nil {
+		return err
+	}
+	color.Green("Credential profile [%v] has been removed.", name)
+	return nil
+}
+
+// ScrubCredentials rewrites the terraform files of the darknodes deployed by an
+// older version, which have the cloud credentials written in plaintext.
+func ScrubCredentials(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	tags := ctx.String("tags")
+
+	// Parse nodes from the name/tags
+	nodes, err := parseNodesOrAll(name, tags)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, 0, len(nodes))
+	for _, node := range nodes {
+		scrubbed, err := provider.ScrubCredentials(node)
+		if err != nil {
+			color.Red("failed to scrub credentials of [%v]: %v", node, err)
+			errs = append(errs, err)
+			continue
+		}
+		if scrubbed {
+			color.Green("- ✅ [%v] has been scrubbed.", node)
+		} else {
+			color.Yellow("- [%v] has no credentials in its terraform file.", node)
+		}
+	}
+	return util.HandleErrs(errs)
+}
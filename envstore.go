@@ -0,0 +1,34 @@
+package nodectl
+
+import "fmt"
+
+// Keys of the updater store on the darknode.
+const (
+	envInstalledVersion = "DARKNODE_INSTALLED"
+	envPreviousVersion  = "DARKNODE_PREVIOUS"
+	envUpdateBin        = "UPDATE_BIN"
+	envUpdateBinPaused  = "UPDATE_BIN_PAUSED"
+	envSnapshotPinned   = "DARKNODE_SNAPSHOT_PINNED"
+	envSnapshotVersion  = "DARKNODE_SNAPSHOT_VERSIONID"
+	envConfigVersion    = "DARKNODE_CONFIG_VERSIONID"
+	envArtifactSource   = "ARTIFACT_SOURCE"
+)
+
+// getEnvScript returns the script which prints the value of the key in the
+// updater store.
+func getEnvScript(key string) string {
+	return fmt.Sprintf(`grep '^%v=' $HOME/.darknode/.env | tail -1 | cut -d= -f2 | tr -d '"'`, key)
+}
+
+// setEnvScript returns the script which sets the key in the updater store. The
+// value is a shell word, so literal values need to be quoted with
+// `util.ShellQuote` while `"$var"` is expanded by the shell.
+func setEnvScript(key, value string) string {
+	return fmt.Sprintf(`sed -i '/^%v=/d' $HOME/.darknode/.env && echo %v=%v >> $HOME/.darknode/.env`, key, key, value)
+}
+
+// unsetEnvScript returns the script which removes the key from the updater
+// store.
+func unsetEnvScript(key string) string {
+	return fmt.Sprintf(`sed -i '/^%v=/d' $HOME/.darknode/.env`, key)
+}
@@ -0,0 +1,46 @@
+package nodectl
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/renproject/nodectl/util"
+)
+
+func TestEnvScript(t *testing.T) {
+	home, env := darknodeHome(t, "darknode", "ARTIFACT_SOURCE=public\nUPDATE_BIN=1\n")
+	values := []string{
+		"https://mirror.example.com/ren",
+		"https://mirror.example.com/a$(touch pwned)/b",
+		"s3+https://minio/`touch pwned`",
+		`version/with"quotes'and/slashes`,
+		"a|b&c;d",
+	}
+	for _, value := range values {
+		script := setEnvScript(envArtifactSource, util.ShellQuote(value))
+		if output, err := runScript(t, env, home, script); err != nil {
+			t.Fatalf("cannot set %q, err = %v, output = %v", value, err, output)
+		}
+		store := readEnv(t, home)
+		if store[envArtifactSource] != value {
+			t.Errorf("stored value = %q, want %q", store[envArtifactSource], value)
+		}
+		if store[envUpdateBin] != "1" {
+			t.Errorf("other keys are changed, %v = %q", envUpdateBin, store[envUpdateBin])
+		}
+		if n := strings.Count(readFile(t, filepath.Join(home, ".darknode", ".env")), envArtifactSource+"="); n != 1 {
+			t.Errorf("%v is stored %v times", envArtifactSource, n)
+		}
+	}
+	if output, err := runScript(t, env, home, "ls pwned"); err == nil {
+		t.Errorf("value is executed by the shell: %v", output)
+	}
+
+	if _, err := runScript(t, env, home, unsetEnvScript(envArtifactSource)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := readEnv(t, home)[envArtifactSource]; ok {
+		t.Errorf("%v is not removed", envArtifactSource)
+	}
+}
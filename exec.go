@@ -0,0 +1,185 @@
+package nodectl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/renproject/nodectl/provider"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+)
+
+// ErrEmptyCommand is returned when no command is given to run on the nodes.
+var ErrEmptyCommand = errors.New("please provide the command to run after --")
+
+// ExecResult is the result of running a command on a node.
+type ExecResult struct {
+	Name     string `json:"name"`
+	ExitCode int    `json:"exitCode"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Success returns whether the command has run successfully.
+func (result ExecResult) Success() bool {
+	return result.Error == "" && result.ExitCode == 0
+}
+
+// ExecResults is a list of ExecResult which implements the `Tabular` interface.
+type ExecResults []ExecResult
+
+// Header implements the `Tabular` interface
+func (results ExecResults) Header() []string {
+	return []string{"name", "exit code", "stdout", "stderr", "error"}
+}
+
+// Rows implements the `Tabular` interface
+func (results ExecResults) Rows() [][]string {
+	rows := make([][]string, len(results))
+	for i, result := range results {
+		rows[i] = []string{result.Name, fmt.Sprintf("%v", result.ExitCode), result.Stdout, result.Stderr, result.Error}
+	}
+	return rows
+}
+
+// ExecCommand runs the command given after `--` on the darknodes and prints
+// a summary of the results.
+func ExecCommand(ctx *cli.Context) error {
+	tags := ctx.String("tags")
+	user := ctx.String("user")
+	parallel := ctx.Int("parallel")
+	timeout := ctx.Duration("timeout")
+	format, err := parseOutputFormat(ctx.String("output"))
+	if err != nil {
+		return err
+	}
+	if user != "darknode" && user != "sudo" {
+		return fmt.Errorf("unknown user [%v], please use either darknode or sudo", user)
+	}
+	if parallel <= 0 {
+		return fmt.Errorf("invalid parallel number %v", parallel)
+	}
+
+	// The darknode name comes before the command if tags are not given
+	args := ctx.Args().Slice()
+	name := ""
+	if tags == "" && len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return ErrEmptyCommand
+	}
+	script := execScript(args)
+
+	// Parse the names of the darknode we want to operate
+	nodes, err := util.ParseNodesFromNameAndTags(name, tags)
+	if err != nil {
+		return err
+	}
+
+	results := make(ExecResults, len(nodes))
+	sem := make(chan struct{}, parallel)
+	wg := new(sync.WaitGroup)
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = execOnNode(nodes[i], script, user, timeout)
+		}(i)
+	}
+	wg.Wait()
+
+	if format != OutputTable {
+		if err := printOutput(format, results); err != nil {
+			return err
+		}
+	} else {
+		printExecResults(results)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if !result.Success() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("command failed on %v of %v darknodes", failed, len(results))
+	}
+	return nil
+}
+
+// execScript returns the shell script running the command. A single argument is
+// run as a script, so pipes and redirections can be used when it's quoted as a
+// whole. Otherwise each argument is quoted to keep it as given to nodectl.
+func execScript(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = util.ShellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// execOnNode runs the script on the node as the given user.
+func execOnNode(name, script, user string, timeout time.Duration) ExecResult {
+	result := ExecResult{Name: name}
+	username := util.NodeInstanceUser(name)
+	if user == "sudo" {
+		var err error
+		if username, err = provider.NodeSudoUsername(name); err != nil {
+			result.ExitCode = -1
+			result.Error = err.Error()
+			return result
+		}
+	}
+	output, err := util.RemoteExec(name, script, username, timeout)
+	result.ExitCode = output.ExitCode
+	result.Stdout = string(output.Stdout)
+	result.Stderr = string(output.Stderr)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// printExecResults prints the output of each node followed by a summary table.
+func printExecResults(results ExecResults) {
+	for _, result := range results {
+		if result.Success() {
+			color.Green("==> [%v] exit code %v", result.Name, result.ExitCode)
+		} else {
+			color.Red("==> [%v] exit code %v", result.Name, result.ExitCode)
+		}
+		if result.Stdout != "" {
+			fmt.Print(strings.TrimSuffix(result.Stdout, "\n") + "\n")
+		}
+		if result.Stderr != "" {
+			color.Yellow("%s", strings.TrimSuffix(result.Stderr, "\n"))
+		}
+		fmt.Println()
+	}
+
+	rows := make([][]string, len(results))
+	for i, result := range results {
+		status := "ok"
+		if !result.Success() {
+			status = "failed"
+		}
+		rows[i] = []string{result.Name, status, fmt.Sprintf("%v", result.ExitCode), result.Error}
+	}
+	printTable([]string{"name", "status", "exit code", "error"}, rows)
+}
@@ -0,0 +1,34 @@
+package nodectl
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestExecScript(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	env := []string{"PATH=" + os.Getenv("PATH")}
+	tests := []struct {
+		name   string
+		args   []string
+		output string
+	}{
+		{"arguments with spaces", []string{"printf", "%s\n", "a b", "c"}, "a b\nc\n"},
+		{"arguments with shell syntax", []string{"echo", "$(echo pwned)", "a|b", "'quoted'"}, "$(echo pwned) a|b 'quoted'\n"},
+		{"single script", []string{"echo a b | tr ' ' '-'"}, "a-b\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := runScript(t, env, t.TempDir(), execScript(test.args))
+			if err != nil {
+				t.Fatalf("cannot run script, err = %v", err)
+			}
+			if output != test.output {
+				t.Errorf("output = %q, want %q", output, test.output)
+			}
+		})
+	}
+}
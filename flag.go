@@ -1,7 +1,10 @@
 package nodectl
 
 import (
+	"time"
+
 	"github.com/renproject/nodectl/provider"
+	"github.com/renproject/nodectl/util"
 	"github.com/urfave/cli/v2"
 )
 
@@ -23,6 +26,10 @@ var (
 		Name:  "snapshot",
 		Usage: "Snapshot of the darknode to recover",
 	}
+	SnapshotVersionFlag = &cli.StringFlag{
+		Name:  "snapshot-version",
+		Usage: "S3 version `ID` of the snapshot, see `nodectl snapshot list`",
+	}
 	NetworkFlag = &cli.StringFlag{
 		Name:        "network",
 		Value:       "mainnet",
@@ -35,7 +42,7 @@ var (
 	}
 	DowngradeFlag = &cli.BoolFlag{
 		Name:  "downgrade",
-		Usage: "Force downgrading to an older version without interactive prompts",
+		Usage: "Allow updating to a version older than the installed one",
 	}
 	ForceFlag = &cli.BoolFlag{
 		Name:    "force",
@@ -55,6 +62,170 @@ var (
 		Name:  "config",
 		Usage: "Update the config file for your darknodes",
 	}
+	OutputFlag = &cli.StringFlag{
+		Name:        "output",
+		Aliases:     []string{"o"},
+		Value:       OutputTable,
+		Usage:       "Output `format`, one of table, json, yaml or csv",
+		DefaultText: OutputTable,
+	}
+	AddressOutputFlag = &cli.StringFlag{
+		Name:        "output",
+		Aliases:     []string{"o"},
+		Value:       OutputJSON,
+		Usage:       "Output `format`, one of table, json, yaml or csv",
+		DefaultText: OutputJSON,
+	}
+	WatchFlag = &cli.BoolFlag{
+		Name:    "watch",
+		Aliases: []string{"w"},
+		Usage:   "Keep refreshing the output until interrupted",
+	}
+	IntervalFlag = &cli.DurationFlag{
+		Name:        "interval",
+		Value:       10 * time.Second,
+		Usage:       "Refresh interval of the watch mode",
+		DefaultText: "10s",
+	}
+	FollowFlag = &cli.BoolFlag{
+		Name:    "follow",
+		Aliases: []string{"f"},
+		Usage:   "Keep streaming new logs until interrupted",
+	}
+	SinceFlag = &cli.StringFlag{
+		Name:  "since",
+		Usage: "Only show logs since the given `time`, i.e. \"2021-12-01 10:00\" or \"1 hour ago\"",
+	}
+	LinesFlag = &cli.IntFlag{
+		Name:        "lines",
+		Aliases:     []string{"n"},
+		Value:       100,
+		Usage:       "Number of the most recent log lines to show",
+		DefaultText: "100",
+	}
+	UnitFlag = &cli.StringFlag{
+		Name:        "unit",
+		Value:       "darknode",
+		Usage:       "Service to show the logs of, either darknode or darknode-updater",
+		DefaultText: "darknode",
+	}
+	GrepFlag = &cli.StringFlag{
+		Name:  "grep",
+		Usage: "Only show log lines matching the regular `expression`",
+	}
+	ExecUserFlag = &cli.StringFlag{
+		Name:        "user",
+		Value:       "darknode",
+		Usage:       "User to run the command as, either darknode or sudo",
+		DefaultText: "darknode",
+	}
+	ParallelFlag = &cli.IntFlag{
+		Name:        "parallel",
+		Value:       10,
+		Usage:       "Maximum number of darknodes to run the command on at the same time",
+		DefaultText: "10",
+	}
+	TimeoutFlag = &cli.DurationFlag{
+		Name:        "timeout",
+		Value:       5 * time.Minute,
+		Usage:       "Kill the command if it doesn't finish in time, 0 means no timeout",
+		DefaultText: "5m",
+	}
+	RecursiveFlag = &cli.BoolFlag{
+		Name:    "recursive",
+		Aliases: []string{"r"},
+		Usage:   "Copy directories recursively",
+	}
+	CredentialsFlag = &cli.StringFlag{
+		Name:  "credentials",
+		Usage: "Name of the stored credential `profile` to use",
+	}
+	EncryptFlag = &cli.BoolFlag{
+		Name:  "encrypt",
+		Usage: "Encrypt the config of the darknode with a passphrase, which can also be given by " + util.PassphraseEnv,
+	}
+	StrategyFlag = &cli.StringFlag{
+		Name:        "strategy",
+		Value:       StrategyAll,
+		Usage:       "Strategy of updating multiple darknodes, either all at once or rolling in batches",
+		DefaultText: StrategyAll,
+	}
+	BatchSizeFlag = &cli.IntFlag{
+		Name:        "batch-size",
+		Value:       1,
+		Usage:       "Number of darknodes updated at the same time in a rolling update",
+		DefaultText: "1",
+	}
+	MaxUnavailableFlag = &cli.IntFlag{
+		Name:        "max-unavailable",
+		Value:       1,
+		Usage:       "Maximum number of darknodes which can be unavailable during a rolling update",
+		DefaultText: "1",
+	}
+	PauseBetweenFlag = &cli.DurationFlag{
+		Name:  "pause-between",
+		Usage: "Time to wait between batches of a rolling update",
+	}
+	CanaryFlag = &cli.StringFlag{
+		Name:  "canary",
+		Usage: "Name of the darknode to update first, the version is only promoted to the other darknodes if it stays healthy",
+	}
+	SoakFlag = &cli.DurationFlag{
+		Name:        "soak",
+		Value:       10 * time.Minute,
+		Usage:       "How long the canary is watched before promoting the version",
+		DefaultText: "10m",
+	}
+	CanaryMaxMemoryFlag = &cli.IntFlag{
+		Name:        "canary-max-memory",
+		Value:       90,
+		Usage:       "Maximum memory usage of the canary darknode in `percent` of the instance memory",
+		DefaultText: "90",
+	}
+	DiskSizeFlag = &cli.IntFlag{
+		Name:  "disk-size",
+		Usage: "Size of the disk in `GB`, it's the block storage volume holding the darknode home on Digital Ocean",
+	}
+	DiskTypeFlag = &cli.StringFlag{
+		Name:  "disk-type",
+		Usage: "Type of the disk, i.e. gp2, gp3 or io1 on AWS and pd-standard, pd-balanced or pd-ssd on Google Cloud",
+	}
+	ArtifactSourceFlag = &cli.StringFlag{
+		Name:  "artifact-source",
+		Usage: "Where the darknode gets its config, snapshots and binaries from, one of public, s3+https://endpoint/bucket, an https mirror or a local directory",
+	}
+)
+
+// Storage flags
+var (
+	BucketFlag = &cli.StringFlag{
+		Name:        "bucket",
+		Value:       BucketName,
+		Usage:       "Name of the S3 bucket to publish to",
+		DefaultText: BucketName,
+	}
+	RegionFlag = &cli.StringFlag{
+		Name:        "region",
+		Value:       BucketRegion,
+		Usage:       "Region of the S3 bucket",
+		DefaultText: BucketRegion,
+	}
+	EndpointFlag = &cli.StringFlag{
+		Name:  "endpoint",
+		Usage: "Endpoint `url` of a S3-compatible storage, instead of AWS S3",
+	}
+	HeightFlag = &cli.Uint64Flag{
+		Name:  "height",
+		Usage: "Block height of the snapshot, which is recorded in its manifest",
+	}
+	UploadFlag = &cli.BoolFlag{
+		Name:  "upload",
+		Usage: "Publish the snapshot to remote storage once it's downloaded",
+	}
+	SourceFlag = &cli.StringFlag{
+		Name:  "source",
+		Usage: "Name of the darknode the snapshot is taken from, which is recorded in its manifest",
+	}
 )
 
 // AWS flags
@@ -73,6 +244,22 @@ var (
 		Aliases: []string{"secret-key", "sk"},
 		Usage:   "AWS secret `key` for programmatic access",
 	}
+	AwsSessionTokenFlag = &cli.StringFlag{
+		Name:  "aws-session-token",
+		Usage: "AWS session `token` of temporary credentials",
+	}
+	AwsRoleArnFlag = &cli.StringFlag{
+		Name:  "aws-role-arn",
+		Usage: "ARN of the AWS IAM `role` to assume",
+	}
+	AwsExternalIDFlag = &cli.StringFlag{
+		Name:  "aws-external-id",
+		Usage: "External `ID` required by the AWS IAM role to assume",
+	}
+	AwsMFASerialFlag = &cli.StringFlag{
+		Name:  "aws-mfa-serial",
+		Usage: "Serial `number` or ARN of the MFA device required by the AWS IAM role to assume",
+	}
 	AwsRegionFlag = &cli.StringFlag{
 		Name:        "aws-region",
 		Usage:       "An optional AWS region",
@@ -87,7 +274,7 @@ var (
 	AwsProfileFlag = &cli.StringFlag{
 		Name:  "aws-profile",
 		Value: "default",
-		Usage: "Name of the profile containing the credentials",
+		Usage: "Name of the profile in the shared AWS config, which can be a SSO profile or use credential_process",
 	}
 )
 
@@ -126,9 +313,9 @@ var (
 	}
 	GcpMachineFlag = &cli.StringFlag{
 		Name:        "gcp-machine",
-		Value:       "n1-standard-1",
+		Value:       provider.DefaultGCPMachine,
 		Usage:       "An optional Google Cloud machine type",
-		DefaultText: "n1-standard-1",
+		DefaultText: provider.DefaultGCPMachine,
 	}
 	GcpRegionFlag = &cli.StringFlag{
 		Name:        "gcp-region",
@@ -136,3 +323,25 @@ var (
 		DefaultText: "random",
 	}
 )
+
+// Existing server flags
+var (
+	SSHFlag = &cli.BoolFlag{
+		Name:  provider.NameSSH,
+		Usage: "An existing server will be used to host the darknode through SSH",
+	}
+	SSHIPFlag = &cli.StringFlag{
+		Name:  "ssh-ip",
+		Usage: "Public IP address of the server",
+	}
+	SSHUserFlag = &cli.StringFlag{
+		Name:        "ssh-user",
+		Value:       provider.DefaultSSHUser,
+		Usage:       "An optional user on the server which has sudo privilege",
+		DefaultText: provider.DefaultSSHUser,
+	}
+	SSHKeyFlag = &cli.StringFlag{
+		Name:  "ssh-key",
+		Usage: "Path of the private key which can be used to SSH into the server as the sudo user",
+	}
+)
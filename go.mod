@@ -11,6 +11,7 @@ require (
 	github.com/hashicorp/go-version v1.4.0
 	github.com/hashicorp/hcl/v2 v2.12.0
 	github.com/joho/godotenv v1.4.0
+	github.com/pkg/sftp v1.13.5
 	github.com/renproject/aw v0.6.1
 	github.com/renproject/id v0.4.2
 	github.com/renproject/multichain v0.5.8
@@ -18,8 +19,10 @@ require (
 	github.com/renproject/surge v1.2.7
 	github.com/urfave/cli/v2 v2.8.1
 	github.com/zclconf/go-cty v1.8.4
-	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5
+	golang.org/x/crypto v0.0.0-20211215153901-e495a2d5b3d3
 	golang.org/x/oauth2 v0.0.0-20220411215720-9780585627b5
+	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 replace github.com/gogo/protobuf => github.com/regen-network/protobuf v1.3.3-alpha.regen.1
@@ -0,0 +1,133 @@
+package nodectl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/renproject/nodectl/provider"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+)
+
+// logUnits are the systemd units we can read the logs of.
+var logUnits = []string{"darknode", "darknode-updater"}
+
+// ShowLogs prints the journal logs of the darknodes. Logs of multiple
+// darknodes are multiplexed into the same output with the node name prefixed
+// to each line.
+func ShowLogs(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	tags := ctx.String("tags")
+	follow := ctx.Bool("follow")
+	since := strings.TrimSpace(ctx.String("since"))
+	lines := ctx.Int("lines")
+	unit := strings.TrimSpace(ctx.String("unit"))
+	if !util.StringInSlice(unit, logUnits) {
+		return fmt.Errorf("unknown unit [%v], supported units are %v", unit, strings.Join(logUnits, ", "))
+	}
+	if lines < 0 {
+		return fmt.Errorf("invalid number of lines %v", lines)
+	}
+	var grep *regexp.Regexp
+	if pattern := ctx.String("grep"); pattern != "" {
+		var err error
+		if grep, err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid grep pattern, err = %v", err)
+		}
+	}
+
+	// Parse the names of the darknode we want to read logs from
+	nodes, err := util.ParseNodesFromNameAndTags(name, tags)
+	if err != nil {
+		return err
+	}
+
+	// User units log into the system journal which needs sudo to read. Fail
+	// right away instead of waiting for a password if sudo asks for one.
+	script := fmt.Sprintf("sudo -n journalctl --user-unit %v --no-pager --output short-iso --lines %v", unit, lines)
+	if since != "" {
+		script += fmt.Sprintf(" --since %v", util.ShellQuote(since))
+	}
+	if follow {
+		script += " --follow"
+	}
+
+	mu := new(sync.Mutex)
+	errs := make([]error, len(nodes))
+	wg := new(sync.WaitGroup)
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			prefix := ""
+			if tags != "" {
+				prefix = fmt.Sprintf("[%v] ", nodes[i])
+			}
+			stdout := &lineWriter{mu: mu, w: os.Stdout, prefix: prefix, grep: grep}
+			stderr := &lineWriter{mu: mu, w: os.Stderr, prefix: prefix}
+			errs[i] = func() error {
+				username, err := provider.NodeSudoUsername(nodes[i])
+				if err != nil {
+					return err
+				}
+				return util.RemoteStream(nodes[i], script, username, stdout, stderr)
+			}()
+			stdout.Flush()
+			stderr.Flush()
+			if errs[i] != nil {
+				color.Red("failed to read logs of [%v]: %v", nodes[i], errs[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+	return util.HandleErrs(errs)
+}
+
+// lineWriter writes complete lines to the underlying writer, so lines from
+// different nodes are not interleaved. Lines not matching the grep pattern are
+// dropped.
+type lineWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	grep   *regexp.Regexp
+	buf    []byte
+}
+
+// Write implements the `io.Writer` interface
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	for {
+		index := bytes.IndexByte(lw.buf, '\n')
+		if index < 0 {
+			break
+		}
+		lw.writeLine(lw.buf[:index])
+		lw.buf = lw.buf[index+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes the remaining incomplete line.
+func (lw *lineWriter) Flush() {
+	if len(lw.buf) > 0 {
+		lw.writeLine(lw.buf)
+		lw.buf = nil
+	}
+}
+
+func (lw *lineWriter) writeLine(line []byte) {
+	if lw.grep != nil && !lw.grep.Match(line) {
+		return
+	}
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	fmt.Fprintf(lw.w, "%v%s\n", lw.prefix, line)
+}
@@ -2,7 +2,6 @@ package nodectl
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -28,11 +27,16 @@ func App() *cli.App {
 			Usage: "Deploy a new Darknode",
 			Flags: []cli.Flag{
 				// General
-				NameFlag, TagsFlag, NetworkFlag, ConfigFlag,
+				NameFlag, TagsFlag, NetworkFlag, ConfigFlag, DiskSizeFlag, DiskTypeFlag, EncryptFlag, CredentialsFlag, ArtifactSourceFlag,
 				// AWS
-				AwsFlag, AwsAccessKeyFlag, AwsSecretKeyFlag, AwsInstanceFlag, AwsRegionFlag, AwsProfileFlag,
+				AwsFlag, AwsAccessKeyFlag, AwsSecretKeyFlag, AwsSessionTokenFlag, AwsInstanceFlag, AwsRegionFlag, AwsProfileFlag,
+				AwsRoleArnFlag, AwsExternalIDFlag, AwsMFASerialFlag,
 				// Digital Ocean
 				DoFlag, DoRegionFlag, DoSizeFlag, DoTokenFlag,
+				// Google Cloud Platform
+				GcpFlag, GcpCredFlag, GcpMachineFlag, GcpRegionFlag,
+				// Existing server
+				SSHFlag, SSHIPFlag, SSHUserFlag, SSHKeyFlag,
 			},
 			Action: func(ctx *cli.Context) error {
 				// Parse the provider and deploy the node
@@ -73,31 +77,205 @@ func App() *cli.App {
 					return err
 				}
 
+				p, err := provider.ParseNodeProvider(name)
+				if err != nil {
+					return err
+				}
 				color.Green("Destroying your Darknode...")
-				destroy := fmt.Sprintf("cd %v &&  destroy --auto-approve && cd .. && rm -rf %v", path, name)
-				return util.Run("bash", "-c", destroy)
+				if err := p.Destroy(name); err != nil {
+					return err
+				}
+				if err := util.RemoveNodeCredentials(name); err != nil {
+					return err
+				}
+				return os.RemoveAll(path)
 			},
 		},
 		{
 			Name:  "update",
 			Usage: "Update your Darknode to the latest version",
-			Flags: []cli.Flag{TagsFlag, VersionFlag, DependencyFlag, ConfigUpdateFlag},
+			Flags: []cli.Flag{
+				TagsFlag, VersionFlag, DependencyFlag, ConfigUpdateFlag,
+				StrategyFlag, BatchSizeFlag, MaxUnavailableFlag, PauseBetweenFlag,
+				CanaryFlag, SoakFlag, CanaryMaxMemoryFlag, DowngradeFlag,
+			},
 			Action: func(c *cli.Context) error {
 				return UpdateDarknode(c)
 			},
 		},
+		{
+			Name:  "rollback",
+			Usage: "Restore the darknode binary replaced by the last update of a single Darknode or a set of Darknodes by its tag",
+			Flags: []cli.Flag{TagsFlag},
+			Action: func(c *cli.Context) error {
+				return RollbackDarknode(c)
+			},
+		},
+		{
+			Name:  "resize",
+			Usage: "Change the instance type of a single Darknode or a set of Darknodes by its tag",
+			Flags: []cli.Flag{TagsFlag, AwsInstanceFlag, DoSizeFlag, GcpMachineFlag},
+			Action: func(c *cli.Context) error {
+				return ResizeDarknode(c)
+			},
+		},
+		{
+			Name:  "disk",
+			Usage: "Manage the disk of a single Darknode or a set of Darknodes by its tag",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "grow",
+					Usage: "Expand the disk and filesystem of the Darknode without stopping it",
+					Flags: []cli.Flag{TagsFlag, DiskSizeFlag},
+					Action: func(c *cli.Context) error {
+						return GrowDisk(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "migrate",
+			Usage: "Record the metadata of Darknodes deployed by an older version, or reconcile it with the cloud resources",
+			Flags: []cli.Flag{TagsFlag},
+			Action: func(c *cli.Context) error {
+				return MigrateDarknode(c)
+			},
+		},
+		{
+			Name:  "keys",
+			Usage: "Manage the encryption of the Darknode configs which contain the private keys",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "encrypt",
+					Usage: "Encrypt the config of a single Darknode, a set of Darknodes by its tag or all Darknodes",
+					Flags: []cli.Flag{TagsFlag},
+					Action: func(c *cli.Context) error {
+						return EncryptKeys(c)
+					},
+				},
+				{
+					Name:  "decrypt",
+					Usage: "Decrypt the config of a single Darknode, a set of Darknodes by its tag or all Darknodes",
+					Flags: []cli.Flag{TagsFlag},
+					Action: func(c *cli.Context) error {
+						return DecryptKeys(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "credentials",
+			Usage: "Manage the cloud credentials of your Darknodes",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "add",
+					Usage:     "Store the credentials of a cloud provider under a profile name, to be used with \"up --credentials\"",
+					ArgsUsage: "<profile>",
+					Flags: []cli.Flag{
+						AwsFlag, AwsAccessKeyFlag, AwsSecretKeyFlag, AwsSessionTokenFlag, AwsProfileFlag,
+						AwsRoleArnFlag, AwsExternalIDFlag, AwsMFASerialFlag,
+						DoFlag, DoTokenFlag,
+						GcpFlag, GcpCredFlag,
+					},
+					Action: func(c *cli.Context) error {
+						return AddCredentials(c)
+					},
+				},
+				{
+					Name:  "list",
+					Usage: "List all the stored credential profiles",
+					Flags: []cli.Flag{OutputFlag},
+					Action: func(c *cli.Context) error {
+						return ListCredentials(c)
+					},
+				},
+				{
+					Name:      "remove",
+					Usage:     "Remove a stored credential profile",
+					ArgsUsage: "<profile>",
+					Action: func(c *cli.Context) error {
+						return RemoveCredentials(c)
+					},
+				},
+				{
+					Name:  "scrub",
+					Usage: "Move the cloud credentials out of the terraform files of a single Darknode, a set of Darknodes by its tag or all Darknodes",
+					Flags: []cli.Flag{TagsFlag},
+					Action: func(c *cli.Context) error {
+						return ScrubCredentials(c)
+					},
+				},
+			},
+		},
 		{
 			Name:  "upload",
-			Usage: "Upload template file to remote storage",
-			Flags: []cli.Flag{ConfigFlag, SnapshotFlag, AwsAccessKeyFlag, AwsSecretKeyFlag, NetworkFlag},
+			Usage: "Upload the config template or publish a snapshot to remote storage",
+			Flags: []cli.Flag{
+				ConfigFlag, SnapshotFlag, NetworkFlag, HeightFlag, SourceFlag,
+				BucketFlag, RegionFlag, EndpointFlag, CredentialsFlag,
+				AwsAccessKeyFlag, AwsSecretKeyFlag, AwsSessionTokenFlag, AwsProfileFlag, AwsRoleArnFlag, AwsExternalIDFlag, AwsMFASerialFlag,
+			},
 			Action: func(c *cli.Context) error {
 				return Upload(c)
 			},
 		},
+		{
+			Name:  "snapshot",
+			Usage: "Manage snapshots of the Darknode database",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "create",
+					Usage:     "Create a snapshot of a healthy Darknode and download it",
+					ArgsUsage: "<name> [path]",
+					Flags: []cli.Flag{
+						UploadFlag, HeightFlag, BucketFlag, RegionFlag, EndpointFlag, CredentialsFlag,
+						AwsAccessKeyFlag, AwsSecretKeyFlag, AwsSessionTokenFlag, AwsProfileFlag, AwsRoleArnFlag, AwsExternalIDFlag, AwsMFASerialFlag,
+					},
+					Action: func(c *cli.Context) error {
+						return CreateSnapshot(c)
+					},
+				},
+				{
+					Name:  "list",
+					Usage: "List all versions of the published snapshots of the network",
+					Flags: []cli.Flag{
+						NetworkFlag, OutputFlag, BucketFlag, RegionFlag, EndpointFlag, CredentialsFlag,
+						AwsAccessKeyFlag, AwsSecretKeyFlag, AwsSessionTokenFlag, AwsProfileFlag, AwsRoleArnFlag, AwsExternalIDFlag, AwsMFASerialFlag,
+					},
+					Action: func(c *cli.Context) error {
+						return ListSnapshots(c)
+					},
+				},
+				{
+					Name:  "pin",
+					Usage: "Pin the updater of a single Darknode or a set of Darknodes by its tag to a snapshot version, instead of recovering from every new snapshot",
+					Flags: []cli.Flag{TagsFlag, SnapshotVersionFlag},
+					Action: func(c *cli.Context) error {
+						return PinSnapshot(c)
+					},
+				},
+				{
+					Name:  "unpin",
+					Usage: "Let the updater of a single Darknode or a set of Darknodes by its tag follow the latest snapshot again",
+					Flags: []cli.Flag{TagsFlag},
+					Action: func(c *cli.Context) error {
+						return UnpinSnapshot(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "source",
+			Usage: "Change where a single Darknode or a set of Darknodes by its tag gets its config, snapshots and binaries from",
+			Flags: []cli.Flag{TagsFlag, ArtifactSourceFlag},
+			Action: func(c *cli.Context) error {
+				return SetArtifactSource(c)
+			},
+		},
 		{
 			Name:  "recover",
 			Usage: "Recover you Darknode from broken state",
-			Flags: []cli.Flag{TagsFlag, SnapshotFlag, ForceFlag},
+			Flags: []cli.Flag{TagsFlag, SnapshotFlag, SnapshotVersionFlag, ForceFlag},
 			Action: func(c *cli.Context) error {
 				return RecoverDarknode(c)
 			},
@@ -106,6 +284,16 @@ func App() *cli.App {
 			Name:  "ssh",
 			Flags: []cli.Flag{},
 			Usage: "SSH into one of your Darknode",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "rekey",
+					Usage: "Replace the recorded host key of the Darknode after a legitimate change",
+					Flags: []cli.Flag{ForceFlag},
+					Action: func(c *cli.Context) error {
+						return RekeyDarknode(c)
+					},
+				},
+			},
 			Action: func(c *cli.Context) error {
 				name := c.Args().First()
 				if err := util.NodeExistence(name); err != nil {
@@ -115,9 +303,19 @@ func App() *cli.App {
 				if err != nil {
 					return err
 				}
+
+				// Record the host key first if it has not been pinned
 				instanceName := util.NodeInstanceUser(name)
+				if _, err := os.Stat(util.KnownHostsPath(name)); os.IsNotExist(err) {
+					client, err := util.Dial(name, instanceName)
+					if err != nil {
+						return err
+					}
+					client.Close()
+				}
 				keyPath := filepath.Join(util.NodePath(name), "ssh_keypair")
-				return util.Run("ssh", "-i", keyPath, fmt.Sprintf("%v@%v", instanceName, ip), "-oStrictHostKeyChecking=no")
+				knownHosts := fmt.Sprintf("-oUserKnownHostsFile=%v", util.KnownHostsPath(name))
+				return util.Run("ssh", "-i", keyPath, fmt.Sprintf("%v@%v", instanceName, ip), knownHosts, "-oStrictHostKeyChecking=yes")
 			},
 		},
 		{
@@ -147,38 +345,51 @@ func App() *cli.App {
 		{
 			Name:  "list",
 			Usage: "List information about all of your Darknodes",
-			Flags: []cli.Flag{TagsFlag},
+			Flags: []cli.Flag{TagsFlag, OutputFlag},
 			Action: func(c *cli.Context) error {
 				return listAllNodes(c)
 			},
 		},
+		{
+			Name:  "status",
+			Usage: "Show the live health of a single Darknode, a set of Darknodes by its tag or all Darknodes",
+			Flags: []cli.Flag{TagsFlag, OutputFlag, WatchFlag, IntervalFlag},
+			Action: func(c *cli.Context) error {
+				return ShowStatus(c)
+			},
+		},
+		{
+			Name:  "logs",
+			Usage: "Show the logs of a single Darknode or a set of Darknodes by its tag",
+			Flags: []cli.Flag{TagsFlag, FollowFlag, SinceFlag, LinesFlag, UnitFlag, GrepFlag},
+			Action: func(c *cli.Context) error {
+				return ShowLogs(c)
+			},
+		},
+		{
+			Name:      "exec",
+			Usage:     "Run a command on a single Darknode or a set of Darknodes by its tag",
+			ArgsUsage: "[name] -- <command>",
+			Flags:     []cli.Flag{TagsFlag, ExecUserFlag, ParallelFlag, TimeoutFlag, OutputFlag},
+			Action: func(c *cli.Context) error {
+				return ExecCommand(c)
+			},
+		},
+		{
+			Name:      "cp",
+			Usage:     "Copy files between your machine and a single Darknode or a set of Darknodes by its tag",
+			ArgsUsage: "<source> <destination>",
+			Flags:     []cli.Flag{TagsFlag, RecursiveFlag, ExecUserFlag},
+			Action: func(c *cli.Context) error {
+				return CopyFiles(c)
+			},
+		},
 		{
 			Name:  "address",
 			Usage: "Show the signed address of the node",
+			Flags: []cli.Flag{AddressOutputFlag},
 			Action: func(c *cli.Context) error {
-				name := c.Args().First()
-				if err := util.NodeExistence(name); err != nil {
-					return err
-				}
-				ip, err := util.NodeIP(name)
-				if err != nil {
-					return err
-				}
-				opts, err := util.NodeOptions(name)
-				if err != nil {
-					return err
-				}
-				for _, peer := range opts.Peers {
-					if strings.HasPrefix(peer.Value, ip) {
-						data, err := json.MarshalIndent(peer, "", "    ")
-						if err != nil {
-							return err
-						}
-						color.Green("%s", data)
-						return nil
-					}
-				}
-				return fmt.Errorf("cannot fetch darknode address")
+				return showAddress(c)
 			},
 		},
 	}
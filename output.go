@@ -0,0 +1,92 @@
+package nodectl
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Formats of the command outputs.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+	OutputCSV   = "csv"
+)
+
+// OutputFormats are all the supported output formats.
+var OutputFormats = []string{OutputTable, OutputJSON, OutputYAML, OutputCSV}
+
+// Tabular is implemented by command results which can be displayed as a table.
+type Tabular interface {
+	Header() []string
+	Rows() [][]string
+}
+
+// parseOutputFormat validates the output format given by the user.
+func parseOutputFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	for _, f := range OutputFormats {
+		if format == f {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format [%v], supported formats are %v", format, strings.Join(OutputFormats, ", "))
+}
+
+// printOutput prints the result to stdout in the given format.
+func printOutput(format string, result Tabular) error {
+	switch format {
+	case OutputJSON:
+		data, err := json.MarshalIndent(result, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	case OutputYAML:
+		// Go through json so that the yaml output shares the same keys
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		data, err = yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	case OutputCSV:
+		w := csv.NewWriter(os.Stdout)
+		if err := w.Write(result.Header()); err != nil {
+			return err
+		}
+		if err := w.WriteAll(result.Rows()); err != nil {
+			return err
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		printTable(result.Header(), result.Rows())
+		return nil
+	}
+}
+
+// printTable prints the rows as a table with aligned columns.
+func printTable(header []string, rows [][]string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t| "))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t| "))
+	}
+	w.Flush()
+}
@@ -2,7 +2,6 @@ package provider
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -28,32 +27,52 @@ import (
 
 const DefaultAWSInstance = "t3.micro"
 
+// Default root volume of the EC2 instance.
+const (
+	DefaultAWSDiskSize = 15
+	DefaultAWSDiskType = "gp2"
+)
+
+// awsDiskTypes are the supported EBS volume types.
+var awsDiskTypes = []string{"gp2", "gp3", "io1"}
+
 type providerAWS struct {
-	accessKey string
-	secretKey string
+	creds util.NodeCredentials
+	cred  *credentials.Credentials
 }
 
 // NewAWS creates an AWS provider.
 func NewAWS(ctx *cli.Context) (Provider, error) {
-	accessKey := ctx.String("aws-access-key")
-	secretKey := ctx.String("aws-secret-key")
+	creds, err := ResolveCredentials(ctx, NameAws)
+	if err != nil {
+		return nil, err
+	}
+	return newAWS(creds)
+}
 
-	// Try reading the default credential file if user does not provide credentials directly
-	if accessKey == "" || secretKey == "" {
-		cred := credentials.NewSharedCredentials("", ctx.String("aws-profile"))
-		credValue, err := cred.Get()
-		if err != nil {
-			return nil, errors.New("invalid credentials")
-		}
-		accessKey, secretKey = credValue.AccessKeyID, credValue.SecretAccessKey
-		if accessKey == "" || secretKey == "" {
-			return nil, errors.New("invalid credentials")
-		}
+// newAWSFromNode creates an AWS provider with the credentials of the node with
+// given name.
+func newAWSFromNode(name string) (Provider, error) {
+	creds, err := nodeCredentials(name)
+	if err != nil {
+		return nil, err
+	}
+	creds, ok := providerCredentials(creds, NameAws)
+	if !ok {
+		return nil, ErrMissingCredential
 	}
+	return newAWS(creds)
+}
 
+// newAWS creates an AWS provider with given credentials.
+func newAWS(creds util.NodeCredentials) (Provider, error) {
+	cred, err := AWSCredentials(creds)
+	if err != nil {
+		return nil, err
+	}
 	return providerAWS{
-		accessKey: accessKey,
-		secretKey: secretKey,
+		creds: creds,
+		cred:  cred,
 	}, nil
 }
 
@@ -68,21 +87,33 @@ func (p providerAWS) Deploy(ctx *cli.Context) error {
 	if err := validateCommonParams(ctx); err != nil {
 		return err
 	}
+	source, err := util.ParseArtifactSource(ctx.String("artifact-source"))
+	if err != nil {
+		return err
+	}
 	name := ctx.String("name")
 	network := multichain.Network(ctx.String("network"))
 	region, instance, err := p.validateRegionAndInstance(ctx)
 	if err != nil {
 		return err
 	}
+	diskSize, diskType, err := p.validateDisk(ctx)
+	if err != nil {
+		return err
+	}
 
 	// Fetch the remote config template
-	templateOpts, err := renvm.OptionTemplate(util.OptionsURL(network))
+	templateOpts, err := util.OptionTemplate(source, network)
 	if err != nil {
 		return err
 	}
 
 	// Get the latest darknode version
-	version, err := util.LatestRelease(network)
+	version, err := source.LatestRelease(network)
+	if err != nil {
+		return err
+	}
+	checksum, err := source.BinaryChecksum(version)
 	if err != nil {
 		return err
 	}
@@ -93,11 +124,11 @@ func (p providerAWS) Deploy(ctx *cli.Context) error {
 	}
 
 	// Get file version ID
-	configVersionID, err := fileVersionID(fmt.Sprintf("%v/config.json", network))
+	configVersionID, err := source.VersionID(network, "config.json")
 	if err != nil {
 		return err
 	}
-	snapshotVersionID, err := fileVersionID(fmt.Sprintf("%v/latest.tar.gz", network))
+	snapshotVersionID, err := source.VersionID(network, util.LatestSnapshot)
 	if err != nil {
 		return err
 	}
@@ -108,17 +139,24 @@ func (p providerAWS) Deploy(ctx *cli.Context) error {
 		Name:               name,
 		Region:             region,
 		InstanceType:       instance,
+		DiskSize:           diskSize,
+		DiskType:           diskType,
 		PubKeyPath:         filepath.Join(util.NodePath(name), "ssh_keypair.pub"),
 		PriKeyPath:         filepath.Join(util.NodePath(name), "ssh_keypair"),
-		AccessKey:          p.accessKey,
-		SecretKey:          p.secretKey,
 		ServiceFile:        filepath.Join(util.NodePath(name), "darknode.service"),
 		UpdaterServiceFile: filepath.Join(util.NodePath(name), "darknode-updater.service"),
 		Version:            version,
+		Checksum:           checksum,
+		Source:             source,
 		ConfigVersionID:    configVersionID,
 		SnapshotVersionID:  snapshotVersionID,
 	}
 
+	// Keep the credentials out of the terraform file
+	if err := util.WriteNodeCredentials(name, p.creds); err != nil {
+		return err
+	}
+
 	// Create the rest service on the cloud
 	color.Green("Deploying darknode...")
 	tfData := tf.GenerateTerraformConfig()
@@ -132,6 +170,17 @@ func (p providerAWS) Deploy(ctx *cli.Context) error {
 	if err := applyTerraform(name); err != nil {
 		return err
 	}
+	meta := util.NodeMetadata{
+		Provider:       NameAws,
+		Region:         region,
+		Instance:       instance,
+		SudoUser:       "ubuntu",
+		Version:        version,
+		ArtifactSource: source.String(),
+	}
+	if err := writeMetadata(ctx, meta); err != nil {
+		return err
+	}
 
 	// Generate the config file using the ip address and template
 	ip, err := util.NodeIP(name)
@@ -148,8 +197,7 @@ func (p providerAWS) Deploy(ctx *cli.Context) error {
 	opts.Selectors = templateOpts.Selectors
 	opts.Chains = templateOpts.Chains
 	opts.Whitelist = templateOpts.Whitelist
-	optionsPath := filepath.Join(util.NodePath(name), "config.json")
-	if err := renvm.OptionsToFile(opts, optionsPath); err != nil {
+	if err := writeNodeOptions(ctx, opts); err != nil {
 		return err
 	}
 
@@ -173,16 +221,212 @@ func (p providerAWS) Deploy(ctx *cli.Context) error {
 	return nil
 }
 
+// Destroy implements the `Provider` interface
+func (p providerAWS) Destroy(name string) error {
+	service, err := p.nodeService(name)
+	if err != nil {
+		return err
+	}
+
+	// Record the resources owned by the node before terraform forgets them, so
+	// we only clean up what was created for this node.
+	resources, err := terraformResources(name)
+	if err != nil {
+		color.Yellow("Cannot read terraform state, leftover resources need to be removed manually, err = %v", err)
+	}
+	allocationID := resourceString(resources, "aws_eip.darknode", "allocation_id")
+	keyPairID := resourceString(resources, "aws_key_pair.darknode", "key_pair_id")
+	fingerprint := resourceString(resources, "aws_key_pair.darknode", "fingerprint")
+	if err := destroyTerraform(name); err != nil {
+		return err
+	}
+
+	// Release the elastic IP in case it's not released by terraform, as AWS
+	// keeps charging for unattached elastic IPs.
+	if allocationID != "" {
+		addresses, err := service.DescribeAddresses(&ec2.DescribeAddressesInput{
+			Filters: []*ec2.Filter{
+				{
+					Name:   aws.String("allocation-id"),
+					Values: []*string{aws.String(allocationID)},
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		for _, address := range addresses.Addresses {
+			if address.AssociationId != nil {
+				continue
+			}
+			color.Yellow("Releasing elastic IP %v", aws.StringValue(address.PublicIp))
+			if _, err := service.ReleaseAddress(&ec2.ReleaseAddressInput{AllocationId: address.AllocationId}); err != nil {
+				return fmt.Errorf("cannot release elastic IP %v, err = %v", aws.StringValue(address.PublicIp), err)
+			}
+		}
+	}
+
+	// Remove the key pair of the node
+	if keyPairID == "" || fingerprint == "" {
+		return nil
+	}
+	keys, err := service.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("key-pair-id"),
+				Values: []*string{aws.String(keyPairID)},
+			},
+			{
+				Name:   aws.String("fingerprint"),
+				Values: []*string{aws.String(fingerprint)},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys.KeyPairs {
+		if _, err := service.DeleteKeyPair(&ec2.DeleteKeyPairInput{KeyPairId: key.KeyPairId}); err != nil {
+			return fmt.Errorf("cannot delete key pair %v, err = %v", aws.StringValue(key.KeyName), err)
+		}
+	}
+	return nil
+}
+
+// Status implements the `Provider` interface
+func (p providerAWS) Status(name string) (string, error) {
+	service, err := p.nodeService(name)
+	if err != nil {
+		return "", err
+	}
+	instance, err := p.nodeInstance(service, name)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(instance.State.Name), nil
+}
+
+// Resize implements the `Provider` interface
+func (p providerAWS) Resize(name, size string) error {
+	config, err := terraformProviderConfig(name, "aws")
+	if err != nil {
+		return err
+	}
+	size = strings.ToLower(strings.TrimSpace(size))
+	if err := p.instanceTypesAvailability(config["region"], size); err != nil {
+		return fmt.Errorf("selected instance type [%v] is not available in region %v", size, config["region"])
+	}
+	return updateInPlace(name, "aws_instance", "darknode", map[string]cty.Value{"instance_type": cty.StringVal(size)}, true)
+}
+
+// GrowDisk implements the `Provider` interface
+func (p providerAWS) GrowDisk(name string, size int) error {
+	current, err := terraformAttribute(name, "aws_instance", "darknode", "root_block_device.volume_size")
+	if err != nil {
+		return err
+	}
+	if err := validateDiskGrowth(current, size); err != nil {
+		return err
+	}
+	if err := updateInPlace(name, "aws_instance", "darknode", awsDiskAttributes(name, size), false); err != nil {
+		return err
+	}
+	return growFilesystem(name, "/")
+}
+
+// awsDiskAttributes returns the attributes of the root volume to update when
+// growing it to the given size. Provisioned IOPS scale with the size of io1
+// volumes, the same as a fresh deployment.
+func awsDiskAttributes(name string, size int) map[string]cty.Value {
+	attrs := map[string]cty.Value{"root_block_device.volume_size": cty.NumberIntVal(int64(size))}
+	diskType, err := terraformAttribute(name, "aws_instance", "darknode", "root_block_device.volume_type")
+	if err == nil && diskType.Type() == cty.String && diskType.AsString() == "io1" {
+		attrs["root_block_device.iops"] = cty.NumberIntVal(int64(awsIOPS(size)))
+	}
+	return attrs
+}
+
+// validateDisk returns the size and type of the root volume.
+func (p providerAWS) validateDisk(ctx *cli.Context) (int, string, error) {
+	size := ctx.Int("disk-size")
+	diskType := strings.ToLower(strings.TrimSpace(ctx.String("disk-type")))
+	if size == 0 {
+		size = DefaultAWSDiskSize
+	}
+	if diskType == "" {
+		diskType = DefaultAWSDiskType
+	}
+	if size < DefaultAWSDiskSize {
+		return 0, "", fmt.Errorf("disk size cannot be less than %vGB", DefaultAWSDiskSize)
+	}
+	if !util.StringInSlice(diskType, awsDiskTypes) {
+		return 0, "", fmt.Errorf("invalid disk type [%v], supported types are %v", diskType, strings.Join(awsDiskTypes, ", "))
+	}
+	return size, diskType, nil
+}
+
+// awsIOPS returns the provisioned IOPS of an io1 volume with given size, which
+// is the maximum ratio allowed by AWS.
+func awsIOPS(size int) int {
+	iops := size * 50
+	if iops > 64000 {
+		iops = 64000
+	}
+	return iops
+}
+
+// nodeService returns the EC2 client of the region where the node with given
+// name is deployed.
+func (p providerAWS) nodeService(name string) (*ec2.EC2, error) {
+	config, err := terraformProviderConfig(name, "aws")
+	if err != nil {
+		return nil, err
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(config["region"]),
+		Credentials: p.cred,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ec2.New(sess), nil
+}
+
+// nodeInstance returns the EC2 instance which hosts the node with given name.
+func (p providerAWS) nodeInstance(service *ec2.EC2, name string) (*ec2.Instance, error) {
+	result, err := service.DescribeInstances(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:Name"),
+				Values: []*string{aws.String(name)},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			if aws.StringValue(instance.State.Name) != ec2.InstanceStateNameTerminated {
+				return instance, nil
+			}
+		}
+	}
+	return nil, ErrInstanceNotFound
+}
+
 func (p providerAWS) validateRegionAndInstance(ctx *cli.Context) (string, string, error) {
-	cred := credentials.NewStaticCredentials(p.accessKey, p.secretKey, "")
 	region := strings.ToLower(strings.TrimSpace(ctx.String("aws-region")))
 	instance := strings.ToLower(strings.TrimSpace(ctx.String("aws-instance")))
 
 	// Get all available regions
 	sess, err := session.NewSession(&aws.Config{
 		Region:      aws.String("us-east-1"),
-		Credentials: cred,
+		Credentials: p.cred,
 	})
+	if err != nil {
+		return "", "", err
+	}
 	service := ec2.New(sess)
 	input := &ec2.DescribeRegionsInput{}
 	result, err := service.DescribeRegions(input)
@@ -199,21 +443,21 @@ func (p providerAWS) validateRegionAndInstance(ctx *cli.Context) (string, string
 		indexes := rand.Perm(len(result.Regions))
 		for _, index := range indexes {
 			region = *result.Regions[index].RegionName
-			if err := p.instanceTypesAvailability(cred, region, instance); err == nil {
+			if err := p.instanceTypesAvailability(region, instance); err == nil {
 				return region, instance, nil
 			}
 		}
 		return "", "", fmt.Errorf("selected instance type [%v] is not available across all regions", instance)
 	} else {
-		err = p.instanceTypesAvailability(cred, region, instance)
+		err = p.instanceTypesAvailability(region, instance)
 		return region, instance, err
 	}
 }
 
-func (p providerAWS) instanceTypesAvailability(cred *credentials.Credentials, region, instance string) error {
+func (p providerAWS) instanceTypesAvailability(region, instance string) error {
 	instanceSession, err := session.NewSession(&aws.Config{
 		Region:      aws.String(region),
-		Credentials: cred,
+		Credentials: p.cred,
 	})
 	if err != nil {
 		return err
@@ -241,13 +485,15 @@ type terraformAWS struct {
 	InstanceType       string
 	PubKeyPath         string
 	PriKeyPath         string
-	AccessKey          string
-	SecretKey          string
 	ServiceFile        string
 	UpdaterServiceFile string
 	Version            string
+	Checksum           string
+	Source             util.ArtifactSource
 	ConfigVersionID    string
 	SnapshotVersionID  string
+	DiskSize           int
+	DiskType           string
 }
 
 func (aws terraformAWS) GenerateTerraformConfig() []byte {
@@ -257,8 +503,6 @@ func (aws terraformAWS) GenerateTerraformConfig() []byte {
 	providerBlock := rootBody.AppendNewBlock("provider", []string{"aws"})
 	providerBody := providerBlock.Body()
 	providerBody.SetAttributeValue("region", cty.StringVal(aws.Region))
-	providerBody.SetAttributeValue("access_key", cty.StringVal(aws.AccessKey))
-	providerBody.SetAttributeValue("secret_key", cty.StringVal(aws.SecretKey))
 
 	eipBlock := rootBody.AppendNewBlock("resource", []string{"aws_eip", "darknode"})
 	eipBody := eipBlock.Body()
@@ -273,6 +517,9 @@ func (aws terraformAWS) GenerateTerraformConfig() []byte {
 			Name: "id",
 		},
 	})
+	eipBody.SetAttributeValue("tags", cty.ObjectVal(map[string]cty.Value{
+		"Name": cty.StringVal(aws.Name),
+	}))
 
 	imageBlock := rootBody.AppendNewBlock("data", []string{"aws_ami", "ubuntu"})
 	imageBody := imageBlock.Body()
@@ -424,8 +671,11 @@ func (aws terraformAWS) GenerateTerraformConfig() []byte {
 
 	rootBlockDevice := instanceBody.AppendNewBlock("root_block_device", nil)
 	rootBlockDeviceBody := rootBlockDevice.Body()
-	rootBlockDeviceBody.SetAttributeValue("volume_type", cty.StringVal("gp2"))
-	rootBlockDeviceBody.SetAttributeValue("volume_size", cty.NumberIntVal(15))
+	rootBlockDeviceBody.SetAttributeValue("volume_type", cty.StringVal(aws.DiskType))
+	rootBlockDeviceBody.SetAttributeValue("volume_size", cty.NumberIntVal(int64(aws.DiskSize)))
+	if aws.DiskType == "io1" {
+		rootBlockDeviceBody.SetAttributeValue("iops", cty.NumberIntVal(int64(awsIOPS(aws.DiskSize))))
+	}
 
 	remoteExecBlock := instanceBody.AppendNewBlock("provisioner", []string{"remote-exec"})
 	remoteExecBody := remoteExecBlock.Body()
@@ -550,19 +800,20 @@ func (aws terraformAWS) GenerateTerraformConfig() []byte {
 	updaterServiceConnectionBody.AppendUnstructuredTokens(key)
 	updaterServiceConnectionBody.AppendNewline()
 
-	snapshotURL := util.SnapshotURL(aws.Network, "")
+	snapshotURL := aws.Source.FileURL(aws.Network, util.LatestSnapshot)
 	remoteExec2Block := instanceBody.AppendNewBlock("provisioner", []string{"remote-exec"})
 	remoteExec2Body := remoteExec2Block.Body()
 	remoteExec2Body.SetAttributeValue("inline", cty.ListVal([]cty.Value{
 		cty.StringVal("set -x"),
 		cty.StringVal("mkdir -p $HOME/.darknode/bin"),
 		cty.StringVal("mkdir -p $HOME/.config/systemd/user"),
-		cty.StringVal(fmt.Sprintf("cd .darknode && curl -sSOJL %v && tar xzf latest.tar.gz", snapshotURL)),
+		cty.StringVal(fmt.Sprintf("cd .darknode && curl -sSOJL %v && tar xzf latest.tar.gz", util.ShellQuote(snapshotURL))),
 		cty.StringVal("rm latest.tar.gz"),
 		cty.StringVal("mv $HOME/darknode.service $HOME/.config/systemd/user/darknode.service"),
 		cty.StringVal("mv $HOME/darknode-updater.service $HOME/.config/systemd/user/darknode-updater.service"),
-		cty.StringVal(fmt.Sprintf("curl -sL https://github.com/renproject/darknode-release/releases/download/%v/darknode > ~/.darknode/bin/darknode", aws.Version)),
-		cty.StringVal("curl -sL https://github.com/renproject/nodectl/releases/latest/download/darknode-updater > ~/.darknode/bin/darknode-updater"),
+		cty.StringVal(fmt.Sprintf("curl -sL %v > ~/.darknode/bin/darknode", util.ShellQuote(aws.Source.BinaryURL(aws.Version)))),
+		cty.StringVal(util.VerifyChecksumScript("$HOME/.darknode/bin/darknode", aws.Checksum)),
+		cty.StringVal(fmt.Sprintf("curl -sL %v > ~/.darknode/bin/darknode-updater", util.ShellQuote(aws.Source.UpdaterURL()))),
 		cty.StringVal("chmod +x ~/.darknode/bin/darknode"),
 		cty.StringVal("chmod +x ~/.darknode/bin/darknode-updater"),
 		cty.StringVal("loginctl enable-linger darknode"),
@@ -572,6 +823,7 @@ func (aws terraformAWS) GenerateTerraformConfig() []byte {
 		cty.StringVal(fmt.Sprintf("echo 'DARKNODE_SNAPSHOT_VERSIONID=%v' >> .env", aws.SnapshotVersionID)),
 		cty.StringVal(fmt.Sprintf("echo 'DARKNODE_CONFIG_VERSIONID=%v' >> .env", aws.ConfigVersionID)),
 		cty.StringVal(fmt.Sprintf("echo 'DARKNODE_INSTALLED=%v' >> .env", aws.Version)),
+		cty.StringVal(fmt.Sprintf("echo ARTIFACT_SOURCE=%v >> .env", util.ShellQuote(aws.Source.String()))),
 		cty.StringVal("echo 'UPDATE_BIN=1' >> .env"),
 		cty.StringVal("echo 'UPDATE_CONFIG=1' >> .env"),
 		cty.StringVal("echo 'UPDATE_RECOVERY=1' >> .env"),
@@ -0,0 +1,242 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+)
+
+// awsRoleDuration is how long the credentials of the assumed role are valid.
+const awsRoleDuration = time.Hour
+
+// awsCredentials caches the AWS credentials, so temporary credentials are
+// reused within the session and the MFA code is only asked once.
+var (
+	awsCredentialsMu = new(sync.Mutex)
+	awsCredentials   = map[util.NodeCredentials]*credentials.Credentials{}
+)
+
+// ResolveCredentials returns the credentials of the given provider. It tries
+// the command-line flags first, then the environment variables, then the stored
+// credential profile given by `--credentials`, and finally the shared AWS
+// config. For AWS, the role given by `--aws-role-arn` is assumed on top of the
+// credentials.
+func ResolveCredentials(ctx *cli.Context, provider string) (util.NodeCredentials, error) {
+	creds, err := resolveCredentials(ctx, provider)
+	if err != nil || provider != NameAws {
+		return creds, err
+	}
+
+	if roleArn := strings.TrimSpace(ctx.String("aws-role-arn")); roleArn != "" {
+		creds.AwsRoleArn = roleArn
+		creds.AwsExternalID = strings.TrimSpace(ctx.String("aws-external-id"))
+		creds.AwsMFASerial = strings.TrimSpace(ctx.String("aws-mfa-serial"))
+	}
+
+	// Make sure we can get the credentials, this assumes the role or logs in
+	// through SSO if needed.
+	cred, err := AWSCredentials(creds)
+	if err != nil {
+		return util.NodeCredentials{}, err
+	}
+	if _, err := cred.Get(); err != nil {
+		return util.NodeCredentials{}, fmt.Errorf("invalid aws credentials, err = %v", err)
+	}
+	return creds, nil
+}
+
+func resolveCredentials(ctx *cli.Context, provider string) (util.NodeCredentials, error) {
+	if provider != NameAws && provider != NameDo && provider != NameGcp {
+		return util.NodeCredentials{}, ErrUnknownProvider
+	}
+
+	// Command-line flags
+	creds := util.NodeCredentials{
+		AwsAccessKey:    ctx.String("aws-access-key"),
+		AwsSecretKey:    ctx.String("aws-secret-key"),
+		AwsSessionToken: ctx.String("aws-session-token"),
+		DoToken:         ctx.String("do-token"),
+		GcpCredFile:     strings.TrimSpace(ctx.String("gcp-credentials")),
+	}
+	if creds, ok := providerCredentials(creds, provider); ok {
+		return absCredFile(creds)
+	}
+
+	// Environment variables
+	creds = util.NodeCredentials{
+		AwsAccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		AwsSecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		AwsSessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		DoToken:         os.Getenv("DIGITALOCEAN_TOKEN"),
+		GcpCredFile:     os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"),
+	}
+	if creds.DoToken == "" {
+		creds.DoToken = os.Getenv("DIGITALOCEAN_ACCESS_TOKEN")
+	}
+	if creds, ok := providerCredentials(creds, provider); ok {
+		return absCredFile(creds)
+	}
+
+	// Stored credential profile
+	if name := ctx.String("credentials"); name != "" {
+		profile, err := util.ReadCredentialProfile(name)
+		if err != nil {
+			return util.NodeCredentials{}, err
+		}
+		if profile.Provider != provider {
+			return util.NodeCredentials{}, fmt.Errorf("credential profile [%v] is for %v, not %v", name, profile.Provider, provider)
+		}
+		if creds, ok := providerCredentials(profile.Credentials, provider); ok {
+			creds.Profile = name
+			return creds, nil
+		}
+		return util.NodeCredentials{}, fmt.Errorf("credential profile [%v] is incomplete", name)
+	}
+
+	// Shared AWS config, which can also be a SSO profile or use an external
+	// credential process
+	if provider == NameAws {
+		profile := ctx.String("aws-profile")
+		if !ctx.IsSet("aws-profile") && os.Getenv("AWS_PROFILE") != "" {
+			profile = os.Getenv("AWS_PROFILE")
+		}
+		if profile == "" {
+			profile = "default"
+		}
+		return util.NodeCredentials{AwsProfile: profile}, nil
+	}
+	return util.NodeCredentials{}, ErrMissingCredential
+}
+
+// providerCredentials keeps only the credentials of the given provider and
+// returns whether they are complete.
+func providerCredentials(creds util.NodeCredentials, provider string) (util.NodeCredentials, bool) {
+	switch provider {
+	case NameAws:
+		creds = util.NodeCredentials{
+			AwsAccessKey:    creds.AwsAccessKey,
+			AwsSecretKey:    creds.AwsSecretKey,
+			AwsSessionToken: creds.AwsSessionToken,
+			AwsProfile:      creds.AwsProfile,
+			AwsRoleArn:      creds.AwsRoleArn,
+			AwsExternalID:   creds.AwsExternalID,
+			AwsMFASerial:    creds.AwsMFASerial,
+		}
+		return creds, (creds.AwsAccessKey != "" && creds.AwsSecretKey != "") || creds.AwsProfile != ""
+	case NameDo:
+		creds = util.NodeCredentials{
+			DoToken: creds.DoToken,
+		}
+		return creds, creds.DoToken != ""
+	case NameGcp:
+		creds = util.NodeCredentials{
+			GcpCredFile: creds.GcpCredFile,
+		}
+		return creds, creds.GcpCredFile != ""
+	default:
+		return util.NodeCredentials{}, false
+	}
+}
+
+// absCredFile converts the path of the credential file to an absolute path, so
+// it still works when running terraform in the darknode folder.
+func absCredFile(creds util.NodeCredentials) (util.NodeCredentials, error) {
+	if creds.GcpCredFile == "" {
+		return creds, nil
+	}
+	path, err := filepath.Abs(creds.GcpCredFile)
+	if err != nil {
+		return util.NodeCredentials{}, err
+	}
+	creds.GcpCredFile = path
+	return creds, nil
+}
+
+// AWSCredentials returns the credentials for the AWS SDK. The static keys are
+// used if given, otherwise the credentials are loaded from the profile of the
+// shared AWS config, including SSO and `credential_process`. The role is
+// assumed on top of them if given, asking for the MFA code when required.
+func AWSCredentials(creds util.NodeCredentials) (*credentials.Credentials, error) {
+	awsCredentialsMu.Lock()
+	defer awsCredentialsMu.Unlock()
+
+	if cred, ok := awsCredentials[creds]; ok {
+		return cred, nil
+	}
+
+	var cred *credentials.Credentials
+	if creds.AwsAccessKey != "" {
+		cred = credentials.NewStaticCredentials(creds.AwsAccessKey, creds.AwsSecretKey, creds.AwsSessionToken)
+	} else {
+		sess, err := session.NewSessionWithOptions(session.Options{
+			Config:                  aws.Config{CredentialsChainVerboseErrors: aws.Bool(true)},
+			Profile:                 creds.AwsProfile,
+			SharedConfigState:       session.SharedConfigEnable,
+			AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot load aws profile [%v], err = %v", creds.AwsProfile, err)
+		}
+		cred = sess.Config.Credentials
+	}
+
+	if creds.AwsRoleArn != "" {
+		sess, err := session.NewSession(&aws.Config{
+			Region:      aws.String("us-east-1"),
+			Credentials: cred,
+		})
+		if err != nil {
+			return nil, err
+		}
+		cred = stscreds.NewCredentials(sess, creds.AwsRoleArn, assumeRoleOptions(creds))
+	}
+	awsCredentials[creds] = cred
+	return cred, nil
+}
+
+// assumeRoleOptions configures the provider assuming the role with the external
+// ID and the MFA device of the credentials. The MFA code is read from stdin.
+func assumeRoleOptions(creds util.NodeCredentials) func(*stscreds.AssumeRoleProvider) {
+	return func(p *stscreds.AssumeRoleProvider) {
+		p.Duration = awsRoleDuration
+		if creds.AwsExternalID != "" {
+			p.ExternalID = aws.String(creds.AwsExternalID)
+		}
+		if creds.AwsMFASerial != "" {
+			p.SerialNumber = aws.String(creds.AwsMFASerial)
+			p.TokenProvider = stscreds.StdinTokenProvider
+		}
+	}
+}
+
+// terraformEnv returns the environment variables which provide the credentials
+// to terraform. AWS profiles and roles are resolved to temporary credentials
+// first, so terraform uses exactly the same credentials as nodectl.
+func terraformEnv(creds util.NodeCredentials) ([]string, error) {
+	if creds.AwsProfile != "" || creds.AwsRoleArn != "" {
+		cred, err := AWSCredentials(creds)
+		if err != nil {
+			return nil, err
+		}
+		value, err := cred.Get()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get aws credentials, err = %v", err)
+		}
+		creds = util.NodeCredentials{
+			AwsAccessKey:    value.AccessKeyID,
+			AwsSecretKey:    value.SecretAccessKey,
+			AwsSessionToken: value.SessionToken,
+		}
+	}
+	return creds.Env(), nil
+}
@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/renproject/nodectl/util"
+)
+
+func TestAssumeRoleOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		creds      util.NodeCredentials
+		externalID string
+		serial     string
+	}{
+		{
+			name:  "role only",
+			creds: util.NodeCredentials{AwsRoleArn: "arn:aws:iam::123456789012:role/darknode"},
+		},
+		{
+			name: "external id",
+			creds: util.NodeCredentials{
+				AwsRoleArn:    "arn:aws:iam::123456789012:role/darknode",
+				AwsExternalID: "external",
+			},
+			externalID: "external",
+		},
+		{
+			name: "mfa",
+			creds: util.NodeCredentials{
+				AwsRoleArn:   "arn:aws:iam::123456789012:role/darknode",
+				AwsMFASerial: "arn:aws:iam::123456789012:mfa/alice",
+			},
+			serial: "arn:aws:iam::123456789012:mfa/alice",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &stscreds.AssumeRoleProvider{}
+			assumeRoleOptions(test.creds)(p)
+
+			if p.Duration != awsRoleDuration {
+				t.Errorf("duration = %v, want %v", p.Duration, awsRoleDuration)
+			}
+			if got := aws.StringValue(p.ExternalID); got != test.externalID {
+				t.Errorf("external id = %q, want %q", got, test.externalID)
+			}
+			if got := aws.StringValue(p.SerialNumber); got != test.serial {
+				t.Errorf("serial number = %q, want %q", got, test.serial)
+			}
+			if hasToken := p.TokenProvider != nil; hasToken != (test.serial != "") {
+				t.Errorf("token provider set = %v, want %v", hasToken, test.serial != "")
+			}
+		})
+	}
+}
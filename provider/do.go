@@ -3,11 +3,13 @@ package provider
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -26,19 +28,45 @@ import (
 
 const DefaultDigitalOceanDroplet = "s-1vcpu-1gb"
 
+// DefaultDODiskSize is the size of the block storage volume which holds the
+// home directory of the darknode.
+const DefaultDODiskSize = 15
+
+// doVolumeRegex matches the characters which are not allowed in the name of a
+// Digital Ocean volume.
+var doVolumeRegex = regexp.MustCompile("[^a-z0-9-]")
+
 type providerDO struct {
-	token string
+	token   string
+	profile string
 }
 
 // NewDo creates a Digital Ocean provider.
 func NewDo(ctx *cli.Context) (Provider, error) {
-	token := ctx.String("do-token")
-	if token == "" {
-		return nil, ErrMissingCredential
+	creds, err := ResolveCredentials(ctx, NameDo)
+	if err != nil {
+		return nil, err
 	}
 
 	return providerDO{
-		token: token,
+		token:   creds.DoToken,
+		profile: creds.Profile,
+	}, nil
+}
+
+// newDoFromNode creates a Digital Ocean provider with the credentials of the
+// node with given name.
+func newDoFromNode(name string) (Provider, error) {
+	creds, err := nodeCredentials(name)
+	if err != nil {
+		return nil, err
+	}
+	if creds.DoToken == "" {
+		return nil, ErrMissingCredential
+	}
+	return providerDO{
+		token:   creds.DoToken,
+		profile: creds.Profile,
 	}, nil
 }
 
@@ -53,21 +81,33 @@ func (p providerDO) Deploy(ctx *cli.Context) error {
 	if err := validateCommonParams(ctx); err != nil {
 		return err
 	}
+	source, err := util.ParseArtifactSource(ctx.String("artifact-source"))
+	if err != nil {
+		return err
+	}
 	name := ctx.String("name")
 	network := multichain.Network(ctx.String("network"))
 	region, droplet, err := p.validateRegionAndDroplet(ctx)
 	if err != nil {
 		return err
 	}
+	volumeSize, err := p.validateVolume(ctx)
+	if err != nil {
+		return err
+	}
 
 	// Get the latest darknode version
-	version, err := util.LatestRelease(network)
+	version, err := source.LatestRelease(network)
+	if err != nil {
+		return err
+	}
+	checksum, err := source.BinaryChecksum(version)
 	if err != nil {
 		return err
 	}
 
 	// Fetch the remote config template
-	templateOpts, err := renvm.OptionTemplate(util.OptionsURL(network))
+	templateOpts, err := util.OptionTemplate(source, network)
 	if err != nil {
 		return err
 	}
@@ -78,11 +118,11 @@ func (p providerDO) Deploy(ctx *cli.Context) error {
 	}
 
 	// Get file version ID
-	configVersionID, err := fileVersionID(fmt.Sprintf("%v/config.json", network))
+	configVersionID, err := source.VersionID(network, "config.json")
 	if err != nil {
 		return err
 	}
-	snapshotVersionID, err := fileVersionID(fmt.Sprintf("%v/latest.tar.gz", network))
+	snapshotVersionID, err := source.VersionID(network, util.LatestSnapshot)
 	if err != nil {
 		return err
 	}
@@ -91,18 +131,26 @@ func (p providerDO) Deploy(ctx *cli.Context) error {
 	tf := doTerraform{
 		Network:            network,
 		Name:               name,
-		Token:              p.token,
 		Region:             region.Slug,
 		Size:               droplet,
+		VolumeName:         doVolumeName(name),
+		VolumeSize:         volumeSize,
 		PubKeyPath:         filepath.Join(util.NodePath(name), "ssh_keypair.pub"),
 		PriKeyPath:         filepath.Join(util.NodePath(name), "ssh_keypair"),
 		ServiceFile:        filepath.Join(util.NodePath(name), "darknode.service"),
 		UpdaterServiceFile: filepath.Join(util.NodePath(name), "darknode-updater.service"),
 		Version:            version,
+		Checksum:           checksum,
+		Source:             source,
 		ConfigVersionID:    configVersionID,
 		SnapshotVersionID:  snapshotVersionID,
 	}
 
+	// Keep the credentials out of the terraform file
+	if err := util.WriteNodeCredentials(name, util.NodeCredentials{DoToken: p.token, Profile: p.profile}); err != nil {
+		return err
+	}
+
 	// Deploy all the cloud services we need
 	color.Green("Deploying darknode...")
 	tfData := tf.GenerateTerraformConfig()
@@ -116,6 +164,17 @@ func (p providerDO) Deploy(ctx *cli.Context) error {
 	if err := applyTerraform(name); err != nil {
 		return err
 	}
+	meta := util.NodeMetadata{
+		Provider:       NameDo,
+		Region:         region.Slug,
+		Instance:       droplet,
+		SudoUser:       "root",
+		Version:        version,
+		ArtifactSource: source.String(),
+	}
+	if err := writeMetadata(ctx, meta); err != nil {
+		return err
+	}
 
 	// Generate the config file using the ip address and template
 	ip, err := util.NodeIP(name)
@@ -132,8 +191,7 @@ func (p providerDO) Deploy(ctx *cli.Context) error {
 	opts.Selectors = templateOpts.Selectors
 	opts.Chains = templateOpts.Chains
 	opts.Whitelist = templateOpts.Whitelist
-	optionsPath := filepath.Join(util.NodePath(name), "config.json")
-	if err := renvm.OptionsToFile(opts, optionsPath); err != nil {
+	if err := writeNodeOptions(ctx, opts); err != nil {
 		return err
 	}
 
@@ -157,6 +215,121 @@ func (p providerDO) Deploy(ctx *cli.Context) error {
 	return nil
 }
 
+// Destroy implements the `Provider` interface
+func (p providerDO) Destroy(name string) error {
+	fingerprint, keyErr := util.SshPubKeyFingerprint(name)
+	if err := destroyTerraform(name); err != nil {
+		return err
+	}
+	if keyErr != nil {
+		color.Yellow("Cannot read ssh key of the darknode, it needs to be removed manually, err = %v", keyErr)
+		return nil
+	}
+
+	c, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Remove the ssh key of the node in case it's not removed by terraform
+	client := godo.NewFromToken(p.token)
+	opts := &godo.ListOptions{PerPage: 200}
+	for {
+		keys, response, err := client.Keys.List(c, opts)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if key.Fingerprint != fingerprint {
+				continue
+			}
+			if _, err := client.Keys.DeleteByID(c, key.ID); err != nil {
+				return fmt.Errorf("cannot delete ssh key %v, err = %v", key.Name, err)
+			}
+		}
+		if response.Links == nil || response.Links.IsLastPage() {
+			break
+		}
+		page, err := response.Links.CurrentPage()
+		if err != nil {
+			return err
+		}
+		opts.Page = page + 1
+	}
+	return nil
+}
+
+// Status implements the `Provider` interface
+func (p providerDO) Status(name string) (string, error) {
+	droplet, err := p.nodeDroplet(name)
+	if err != nil {
+		return "", err
+	}
+	return droplet.Status, nil
+}
+
+// Resize implements the `Provider` interface
+func (p providerDO) Resize(name, size string) error {
+	size = strings.ToLower(strings.TrimSpace(size))
+	droplet, err := p.nodeDroplet(name)
+	if err != nil {
+		return err
+	}
+	if droplet.Region == nil || !util.StringInSlice(size, droplet.Region.Sizes) {
+		return fmt.Errorf("selected droplet [%v] not available in the region of the darknode", size)
+	}
+	return updateInPlace(name, "digitalocean_droplet", "darknode", map[string]cty.Value{"size": cty.StringVal(size)}, true)
+}
+
+// GrowDisk implements the `Provider` interface. Only the block storage volume
+// which holds the darknode home directory can be grown, darknodes deployed by
+// older versions without a volume need to be redeployed.
+func (p providerDO) GrowDisk(name string, size int) error {
+	current, err := terraformAttribute(name, "digitalocean_volume", "darknode", "size")
+	if err != nil {
+		return fmt.Errorf("darknode has no block storage volume and its disk cannot be grown, please redeploy it, err = %v", err)
+	}
+	if err := validateDiskGrowth(current, size); err != nil {
+		return err
+	}
+	if err := updateInPlace(name, "digitalocean_volume", "darknode", map[string]cty.Value{"size": cty.NumberIntVal(int64(size))}, false); err != nil {
+		return err
+	}
+	username, err := NodeSudoUsername(name)
+	if err != nil {
+		return err
+	}
+	resize := fmt.Sprintf("sudo resize2fs %v", doVolumeDevice(doVolumeName(name)))
+	return util.RemoteRun(name, resize, username)
+}
+
+// nodeDroplet returns the droplet which hosts the node with given name.
+func (p providerDO) nodeDroplet(name string) (godo.Droplet, error) {
+	c, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client := godo.NewFromToken(p.token)
+	opts := &godo.ListOptions{PerPage: 200}
+	for {
+		droplets, response, err := client.Droplets.List(c, opts)
+		if err != nil {
+			return godo.Droplet{}, err
+		}
+		for _, droplet := range droplets {
+			if droplet.Name == name {
+				return droplet, nil
+			}
+		}
+		if response.Links == nil || response.Links.IsLastPage() {
+			break
+		}
+		page, err := response.Links.CurrentPage()
+		if err != nil {
+			return godo.Droplet{}, err
+		}
+		opts.Page = page + 1
+	}
+	return godo.Droplet{}, ErrInstanceNotFound
+}
+
 func (p providerDO) validateRegionAndDroplet(ctx *cli.Context) (godo.Region, string, error) {
 	region := strings.ToLower(strings.TrimSpace(ctx.String("do-region")))
 	droplet := strings.ToLower(strings.TrimSpace(ctx.String("do-droplet")))
@@ -202,17 +375,46 @@ func (p providerDO) validateRegionAndDroplet(ctx *cli.Context) (godo.Region, str
 	}
 }
 
+// validateVolume returns the size of the block storage volume to attach to the
+// droplet. A volume is always attached, so the disk can be grown later.
+func (p providerDO) validateVolume(ctx *cli.Context) (int, error) {
+	if ctx.String("disk-type") != "" {
+		return 0, errors.New("disk type is not supported by Digital Ocean")
+	}
+	size := ctx.Int("disk-size")
+	if size == 0 {
+		size = DefaultDODiskSize
+	}
+	if size < DefaultDODiskSize {
+		return 0, fmt.Errorf("disk size cannot be less than %vGB", DefaultDODiskSize)
+	}
+	return size, nil
+}
+
+// doVolumeName returns the name of the block storage volume of the node.
+func doVolumeName(name string) string {
+	return "darknode-" + doVolumeRegex.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// doVolumeDevice returns the device path of the volume on the droplet.
+func doVolumeDevice(volume string) string {
+	return fmt.Sprintf("/dev/disk/by-id/scsi-0DO_Volume_%v", volume)
+}
+
 type doTerraform struct {
 	Network            multichain.Network
 	Name               string
-	Token              string
 	Region             string
 	Size               string
+	VolumeName         string
+	VolumeSize         int
 	PubKeyPath         string
 	PriKeyPath         string
 	ServiceFile        string
 	UpdaterServiceFile string
 	Version            string
+	Checksum           string
+	Source             util.ArtifactSource
 	ConfigVersionID    string
 	SnapshotVersionID  string
 }
@@ -227,9 +429,7 @@ func (do doTerraform) GenerateTerraformConfig() []byte {
 		"version": cty.StringVal("~> 2.0"),
 	}))
 
-	providerBlock := rootBody.AppendNewBlock("provider", []string{"digitalocean"})
-	providerBody := providerBlock.Body()
-	providerBody.SetAttributeValue("token", cty.StringVal(do.Token))
+	rootBody.AppendNewBlock("provider", []string{"digitalocean"})
 
 	sshKeyBlock := rootBody.AppendNewBlock("resource", []string{"digitalocean_ssh_key", "darknode"})
 	sshKeyBody := sshKeyBlock.Body()
@@ -269,6 +469,16 @@ func (do doTerraform) GenerateTerraformConfig() []byte {
 	sshKeyBody.AppendUnstructuredTokens(pubKey)
 	sshKeyBody.AppendNewline()
 
+	if do.VolumeSize > 0 {
+		volumeBlock := rootBody.AppendNewBlock("resource", []string{"digitalocean_volume", "darknode"})
+		volumeBody := volumeBlock.Body()
+		volumeBody.SetAttributeValue("region", cty.StringVal(do.Region))
+		volumeBody.SetAttributeValue("name", cty.StringVal(do.VolumeName))
+		volumeBody.SetAttributeValue("size", cty.NumberIntVal(int64(do.VolumeSize)))
+		volumeBody.SetAttributeValue("initial_filesystem_type", cty.StringVal("ext4"))
+		volumeBody.SetAttributeValue("description", cty.StringVal(fmt.Sprintf("Home directory of darknode %v", do.Name)))
+	}
+
 	dropletBlock := rootBody.AppendNewBlock("resource", []string{"digitalocean_droplet", "darknode"})
 	dropletBody := dropletBlock.Body()
 	dropletBody.SetAttributeTraversal("provider", hcl.Traversal{
@@ -316,13 +526,35 @@ func (do doTerraform) GenerateTerraformConfig() []byte {
 	}
 	dropletBody.AppendUnstructuredTokens(sshKeys)
 	dropletBody.AppendNewline()
+	if do.VolumeSize > 0 {
+		dropletBody.AppendUnstructuredTokens(unstructuredAttr("volume_ids", "[digitalocean_volume.darknode.id]"))
+		dropletBody.AppendNewline()
+	}
 
-	remoteExecBlock := dropletBody.AppendNewBlock("provisioner", []string{"remote-exec"})
-	remoteExecBody := remoteExecBlock.Body()
-	remoteExecBody.SetAttributeValue("inline", cty.ListVal([]cty.Value{
+	// Mount the volume as the home directory of the darknode user before the
+	// user is created.
+	setup := []cty.Value{
 		cty.StringVal("set -x"),
 		cty.StringVal("until sudo apt update; do sleep 4; done"),
-		cty.StringVal("sudo adduser darknode --gecos \",,,\" --disabled-password"),
+	}
+	if do.VolumeSize > 0 {
+		device := doVolumeDevice(do.VolumeName)
+		setup = append(setup,
+			cty.StringVal(fmt.Sprintf("sudo umount /mnt/%v || true", do.VolumeName)),
+			cty.StringVal(fmt.Sprintf("sudo sed -i '/%v/d' /etc/fstab", do.VolumeName)),
+			cty.StringVal("sudo mkdir -p /home/darknode"),
+			cty.StringVal(fmt.Sprintf("echo '%v /home/darknode ext4 defaults,nofail,discard 0 2' | sudo tee -a /etc/fstab", device)),
+			cty.StringVal("sudo mount /home/darknode"),
+		)
+	}
+	setup = append(setup, cty.StringVal("sudo adduser darknode --gecos \",,,\" --disabled-password"))
+	if do.VolumeSize > 0 {
+		setup = append(setup, cty.StringVal("sudo chown darknode:darknode /home/darknode"))
+	}
+
+	remoteExecBlock := dropletBody.AppendNewBlock("provisioner", []string{"remote-exec"})
+	remoteExecBody := remoteExecBlock.Body()
+	remoteExecBody.SetAttributeValue("inline", cty.ListVal(append(setup,
 		cty.StringVal("sudo rsync --archive --chown=darknode:darknode ~/.ssh /home/darknode"),
 		cty.StringVal("curl -sSL https://repos.insights.digitalocean.com/install.sh | sudo bash"),
 		cty.StringVal("until sudo apt-get install -y ufw build-essential libhwloc-dev; do sleep 4; done"),
@@ -337,7 +569,7 @@ func (do doTerraform) GenerateTerraformConfig() []byte {
 		cty.StringVal("cd .."),
 		cty.StringVal("rm -r v0.16.1.tar.gz wasmvm-0.16.1"),
 		cty.StringVal("systemctl restart systemd-journald"),
-	}))
+	)))
 
 	connectionBlock := remoteExecBody.AppendNewBlock("connection", nil)
 	connectionBody := connectionBlock.Body()
@@ -424,19 +656,20 @@ func (do doTerraform) GenerateTerraformConfig() []byte {
 	connection4Body.AppendUnstructuredTokens(key)
 	connection4Body.AppendNewline()
 
-	snapshotURL := util.SnapshotURL(do.Network, "")
+	snapshotURL := do.Source.FileURL(do.Network, util.LatestSnapshot)
 	remoteExec2Block := dropletBody.AppendNewBlock("provisioner", []string{"remote-exec"})
 	remoteExec2Body := remoteExec2Block.Body()
 	remoteExec2Body.SetAttributeValue("inline", cty.ListVal([]cty.Value{
 		cty.StringVal("set -x"),
 		cty.StringVal("mkdir -p $HOME/.darknode/bin"),
 		cty.StringVal("mkdir -p $HOME/.config/systemd/user"),
-		cty.StringVal(fmt.Sprintf("cd .darknode && curl -sSOJL %v && tar xzf latest.tar.gz", snapshotURL)),
+		cty.StringVal(fmt.Sprintf("cd .darknode && curl -sSOJL %v && tar xzf latest.tar.gz", util.ShellQuote(snapshotURL))),
 		cty.StringVal("rm latest.tar.gz"),
 		cty.StringVal("mv $HOME/darknode.service $HOME/.config/systemd/user/darknode.service"),
 		cty.StringVal("mv $HOME/darknode-updater.service $HOME/.config/systemd/user/darknode-updater.service"),
-		cty.StringVal(fmt.Sprintf("curl -sL https://github.com/renproject/darknode-release/releases/download/%v/darknode > ~/.darknode/bin/darknode", do.Version)),
-		cty.StringVal("curl -sL https://github.com/renproject/nodectl/releases/latest/download/darknode-updater > ~/.darknode/bin/darknode-updater"),
+		cty.StringVal(fmt.Sprintf("curl -sL %v > ~/.darknode/bin/darknode", util.ShellQuote(do.Source.BinaryURL(do.Version)))),
+		cty.StringVal(util.VerifyChecksumScript("$HOME/.darknode/bin/darknode", do.Checksum)),
+		cty.StringVal(fmt.Sprintf("curl -sL %v > ~/.darknode/bin/darknode-updater", util.ShellQuote(do.Source.UpdaterURL()))),
 		cty.StringVal("chmod +x ~/.darknode/bin/darknode"),
 		cty.StringVal("chmod +x ~/.darknode/bin/darknode-updater"),
 		cty.StringVal("loginctl enable-linger darknode"),
@@ -446,6 +679,7 @@ func (do doTerraform) GenerateTerraformConfig() []byte {
 		cty.StringVal(fmt.Sprintf("echo 'DARKNODE_SNAPSHOT_VERSIONID=%v' >> .env", do.SnapshotVersionID)),
 		cty.StringVal(fmt.Sprintf("echo 'DARKNODE_CONFIG_VERSIONID=%v' >> .env", do.ConfigVersionID)),
 		cty.StringVal(fmt.Sprintf("echo 'DARKNODE_INSTALLED=%v' >> .env", do.Version)),
+		cty.StringVal(fmt.Sprintf("echo ARTIFACT_SOURCE=%v >> .env", util.ShellQuote(do.Source.String()))),
 		cty.StringVal("echo 'UPDATE_BIN=1' >> .env"),
 		cty.StringVal("echo 'UPDATE_CONFIG=1' >> .env"),
 		cty.StringVal("echo 'UPDATE_RECOVERY=1' >> .env"),
@@ -0,0 +1,698 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/renproject/aw/wire"
+	"github.com/renproject/multichain"
+	"github.com/renproject/nodectl/renvm"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const DefaultGCPMachine = "n1-standard-1"
+
+// Default boot disk of the Compute Engine instance.
+const (
+	DefaultGCPDiskSize = 15
+	DefaultGCPDiskType = "pd-standard"
+)
+
+// gcpDiskTypes are the supported persistent disk types.
+var gcpDiskTypes = []string{"pd-standard", "pd-balanced", "pd-ssd"}
+
+// gcpComputeAPI is the base url of the Google Compute Engine REST API.
+const gcpComputeAPI = "https://compute.googleapis.com/compute/v1"
+
+// errResourceNotFound is returned when the requested resource doesn't exist.
+var errResourceNotFound = errors.New("resource not found")
+
+// gcpNameRegex is the naming requirement for Google Cloud resources.
+var gcpNameRegex = regexp.MustCompile("^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$")
+
+type providerGCP struct {
+	credFile  string
+	profile   string
+	projectID string
+	client    *http.Client
+}
+
+// NewGCP creates a Google Cloud Platform provider.
+func NewGCP(ctx *cli.Context) (Provider, error) {
+	creds, err := ResolveCredentials(ctx, NameGcp)
+	if err != nil {
+		return nil, err
+	}
+	return newGCP(creds)
+}
+
+// newGCPFromNode creates a Google Cloud Platform provider with the credentials
+// of the node with given name.
+func newGCPFromNode(name string) (Provider, error) {
+	creds, err := nodeCredentials(name)
+	if err != nil {
+		return nil, err
+	}
+	if creds.GcpCredFile == "" {
+		return nil, ErrMissingCredential
+	}
+	return newGCP(creds)
+}
+
+// newGCP creates a Google Cloud Platform provider from the service account
+// credential file.
+func newGCP(nodeCreds util.NodeCredentials) (Provider, error) {
+	credFile := nodeCreds.GcpCredFile
+	data, err := ioutil.ReadFile(credFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read credential file, err = %v", err)
+	}
+
+	// Make sure the credential file is a service account key.
+	var account struct {
+		Type        string `json:"type"`
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+	}
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("invalid credential file, err = %v", err)
+	}
+	if account.Type != "service_account" || account.ProjectID == "" || account.ClientEmail == "" {
+		return nil, errors.New("invalid credentials, expect a service account key file")
+	}
+
+	creds, err := google.CredentialsFromJSON(context.Background(), data, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials, err = %v", err)
+	}
+
+	return providerGCP{
+		credFile:  credFile,
+		profile:   nodeCreds.Profile,
+		projectID: account.ProjectID,
+		client:    oauth2.NewClient(context.Background(), creds.TokenSource),
+	}, nil
+}
+
+// Name implements the `Provider` interface
+func (p providerGCP) Name() string {
+	return NameGcp
+}
+
+// Deploy implements the `Provider` interface
+func (p providerGCP) Deploy(ctx *cli.Context) error {
+	// Validate all input params
+	if err := validateCommonParams(ctx); err != nil {
+		return err
+	}
+	source, err := util.ParseArtifactSource(ctx.String("artifact-source"))
+	if err != nil {
+		return err
+	}
+	name := ctx.String("name")
+	if !gcpNameRegex.MatchString(name) {
+		return ErrInvalidNodeNameForGCP
+	}
+	network := multichain.Network(ctx.String("network"))
+	region, zone, machine, err := p.validateRegionAndMachine(ctx)
+	if err != nil {
+		return err
+	}
+	diskSize, diskType, err := p.validateDisk(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Fetch the remote config template
+	templateOpts, err := util.OptionTemplate(source, network)
+	if err != nil {
+		return err
+	}
+
+	// Get the latest darknode version
+	version, err := source.LatestRelease(network)
+	if err != nil {
+		return err
+	}
+	checksum, err := source.BinaryChecksum(version)
+	if err != nil {
+		return err
+	}
+
+	// Initialize folder and files for the node
+	if err := initialize(ctx); err != nil {
+		return err
+	}
+
+	// Get file version ID
+	configVersionID, err := source.VersionID(network, "config.json")
+	if err != nil {
+		return err
+	}
+	snapshotVersionID, err := source.VersionID(network, util.LatestSnapshot)
+	if err != nil {
+		return err
+	}
+
+	// Getting everything needed by terraform
+	tf := terraformGCP{
+		Network:            network,
+		Name:               name,
+		Project:            p.projectID,
+		Region:             region,
+		Zone:               zone,
+		MachineType:        machine,
+		DiskSize:           diskSize,
+		DiskType:           diskType,
+		PubKeyPath:         filepath.Join(util.NodePath(name), "ssh_keypair.pub"),
+		PriKeyPath:         filepath.Join(util.NodePath(name), "ssh_keypair"),
+		ServiceFile:        filepath.Join(util.NodePath(name), "darknode.service"),
+		UpdaterServiceFile: filepath.Join(util.NodePath(name), "darknode-updater.service"),
+		Version:            version,
+		Checksum:           checksum,
+		Source:             source,
+		ConfigVersionID:    configVersionID,
+		SnapshotVersionID:  snapshotVersionID,
+	}
+
+	// Keep the credentials out of the terraform file
+	if err := util.WriteNodeCredentials(name, util.NodeCredentials{GcpCredFile: p.credFile, Profile: p.profile}); err != nil {
+		return err
+	}
+
+	// Create the rest service on the cloud
+	color.Green("Deploying darknode...")
+	tfData := tf.GenerateTerraformConfig()
+	tfFile, err := os.Create(filepath.Join(util.NodePath(name), "main.tf"))
+	if err != nil {
+		return err
+	}
+	if _, err := tfFile.Write(tfData); err != nil {
+		return err
+	}
+	if err := applyTerraform(name); err != nil {
+		return err
+	}
+	meta := util.NodeMetadata{
+		Provider:       NameGcp,
+		Region:         region,
+		Instance:       machine,
+		SudoUser:       "ubuntu",
+		Version:        version,
+		ArtifactSource: source.String(),
+	}
+	if err := writeMetadata(ctx, meta); err != nil {
+		return err
+	}
+
+	// Generate the config file using the ip address and template
+	ip, err := util.NodeIP(name)
+	if err != nil {
+		return err
+	}
+	opts := renvm.NewOptions(network)
+	ip = fmt.Sprintf("%v:18514", ip)
+	addr := wire.NewUnsignedAddress(wire.TCP, ip, uint64(time.Now().UnixNano()))
+	if err := addr.Sign(opts.PrivKey); err != nil {
+		return fmt.Errorf("cannot sign address: %v", err)
+	}
+	opts.Peers = append([]wire.Address{addr}, templateOpts.Peers...)
+	opts.Selectors = templateOpts.Selectors
+	opts.Chains = templateOpts.Chains
+	opts.Whitelist = templateOpts.Whitelist
+	if err := writeNodeOptions(ctx, opts); err != nil {
+		return err
+	}
+
+	// Upload the config file to remote instance
+	data, err := json.MarshalIndent(opts, "", "    ")
+	if err != nil {
+		return err
+	}
+	copyConfig := fmt.Sprintf("echo '%s' > $HOME/.darknode/config.json", string(data))
+	if err := util.RemoteRun(name, copyConfig, "darknode"); err != nil {
+		return err
+	}
+
+	// Start the darknode service
+	startService := "systemctl --user start darknode"
+	if err := util.RemoteRun(name, startService, "darknode"); err != nil {
+		return err
+	}
+
+	color.Green("Your darknode is up and running")
+	return nil
+}
+
+// Destroy implements the `Provider` interface
+func (p providerGCP) Destroy(name string) error {
+	config, err := terraformProviderConfig(name, "google")
+	if err != nil {
+		return err
+	}
+	if err := destroyTerraform(name); err != nil {
+		return err
+	}
+
+	// Release the static IP in case it's not released by terraform, as Google
+	// Cloud keeps charging for unused static IPs.
+	address := fmt.Sprintf("projects/%v/regions/%v/addresses/darknode-ip-%v", p.projectID, config["region"], name)
+	err = p.request(http.MethodDelete, address, nil)
+	if err != nil && err != errResourceNotFound {
+		return fmt.Errorf("cannot release static IP, err = %v", err)
+	}
+	return nil
+}
+
+// Status implements the `Provider` interface
+func (p providerGCP) Status(name string) (string, error) {
+	config, err := terraformProviderConfig(name, "google")
+	if err != nil {
+		return "", err
+	}
+	var instance struct {
+		Status string `json:"status"`
+	}
+	resource := fmt.Sprintf("projects/%v/zones/%v/instances/%v", p.projectID, config["zone"], name)
+	if err := p.request(http.MethodGet, resource, &instance); err != nil {
+		if err == errResourceNotFound {
+			return "", ErrInstanceNotFound
+		}
+		return "", err
+	}
+	return strings.ToLower(instance.Status), nil
+}
+
+// Resize implements the `Provider` interface
+func (p providerGCP) Resize(name, size string) error {
+	config, err := terraformProviderConfig(name, "google")
+	if err != nil {
+		return err
+	}
+	size = strings.ToLower(strings.TrimSpace(size))
+	zone := fmt.Sprintf("zones/%v", config["zone"])
+	if _, err := p.machineTypeAvailability([]string{zone}, size); err != nil {
+		return fmt.Errorf("selected machine type [%v] not available in zone %v", size, config["zone"])
+	}
+	return updateInPlace(name, "google_compute_instance", "darknode", map[string]cty.Value{"machine_type": cty.StringVal(size)}, true)
+}
+
+// GrowDisk implements the `Provider` interface
+func (p providerGCP) GrowDisk(name string, size int) error {
+	current, err := terraformAttribute(name, "google_compute_disk", "darknode", "size")
+	if err != nil {
+		return err
+	}
+	if err := validateDiskGrowth(current, size); err != nil {
+		return err
+	}
+	if err := updateInPlace(name, "google_compute_disk", "darknode", map[string]cty.Value{"size": cty.NumberIntVal(int64(size))}, false); err != nil {
+		return err
+	}
+	return growFilesystem(name, "/")
+}
+
+// validateDisk returns the size and type of the boot disk.
+func (p providerGCP) validateDisk(ctx *cli.Context) (int, string, error) {
+	size := ctx.Int("disk-size")
+	diskType := strings.ToLower(strings.TrimSpace(ctx.String("disk-type")))
+	if size == 0 {
+		size = DefaultGCPDiskSize
+	}
+	if diskType == "" {
+		diskType = DefaultGCPDiskType
+	}
+	if size < DefaultGCPDiskSize {
+		return 0, "", fmt.Errorf("disk size cannot be less than %vGB", DefaultGCPDiskSize)
+	}
+	if !util.StringInSlice(diskType, gcpDiskTypes) {
+		return 0, "", fmt.Errorf("invalid disk type [%v], supported types are %v", diskType, strings.Join(gcpDiskTypes, ", "))
+	}
+	return size, diskType, nil
+}
+
+// validateRegionAndMachine returns the region and zone to deploy the instance
+// in. It will use a random region if not specified.
+func (p providerGCP) validateRegionAndMachine(ctx *cli.Context) (string, string, string, error) {
+	region := strings.ToLower(strings.TrimSpace(ctx.String("gcp-region")))
+	machine := strings.ToLower(strings.TrimSpace(ctx.String("gcp-machine")))
+
+	// Fetch all available regions
+	var regionList struct {
+		Items []struct {
+			Name   string   `json:"name"`
+			Status string   `json:"status"`
+			Zones  []string `json:"zones"`
+		} `json:"items"`
+	}
+	if err := p.get(fmt.Sprintf("projects/%v/regions", p.projectID), &regionList); err != nil {
+		return "", "", "", err
+	}
+	if len(regionList.Items) == 0 {
+		return "", "", "", ErrNoAvailableRegion
+	}
+
+	if region == "" {
+		// Randomly select a region which has the given machine type.
+		indexes := rand.Perm(len(regionList.Items))
+		for _, index := range indexes {
+			r := regionList.Items[index]
+			if r.Status != "UP" {
+				continue
+			}
+			if zone, err := p.machineTypeAvailability(r.Zones, machine); err == nil {
+				return r.Name, zone, machine, nil
+			}
+		}
+		return "", "", "", fmt.Errorf("selected machine type [%v] is not available across all regions", machine)
+	} else {
+		for _, r := range regionList.Items {
+			if r.Name == region {
+				zone, err := p.machineTypeAvailability(r.Zones, machine)
+				if err != nil {
+					return "", "", "", fmt.Errorf("selected machine type [%v] not available in region %v", machine, region)
+				}
+				return r.Name, zone, machine, nil
+			}
+		}
+		return "", "", "", fmt.Errorf("region [%v] is not avaliable", region)
+	}
+}
+
+// machineTypeAvailability returns the first zone which has the given machine
+// type.
+func (p providerGCP) machineTypeAvailability(zones []string, machine string) (string, error) {
+	for _, zoneURL := range zones {
+		zone := path.Base(zoneURL)
+		var machineType struct {
+			Name string `json:"name"`
+		}
+		err := p.get(fmt.Sprintf("projects/%v/zones/%v/machineTypes/%v", p.projectID, zone, machine), &machineType)
+		if err == nil && machineType.Name == machine {
+			return zone, nil
+		}
+	}
+	return "", ErrInstanceTypeNotAvailable
+}
+
+// get sends a GET request to the compute API and decodes the response.
+func (p providerGCP) get(resource string, v interface{}) error {
+	return p.request(http.MethodGet, resource, v)
+}
+
+// request sends a request to the compute API and decodes the response if v is
+// not nil.
+func (p providerGCP) request(method, resource string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("%v/%v", gcpComputeAPI, resource)
+	request, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		if v == nil {
+			return nil
+		}
+		return json.NewDecoder(response.Body).Decode(v)
+	case http.StatusNotFound:
+		return errResourceNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrInsufficientPermission
+	default:
+		return util.VerifyStatusCode(response, http.StatusOK)
+	}
+}
+
+type terraformGCP struct {
+	Network            multichain.Network
+	Name               string
+	Project            string
+	Region             string
+	Zone               string
+	MachineType        string
+	DiskSize           int
+	DiskType           string
+	PubKeyPath         string
+	PriKeyPath         string
+	ServiceFile        string
+	UpdaterServiceFile string
+	Version            string
+	Checksum           string
+	Source             util.ArtifactSource
+	ConfigVersionID    string
+	SnapshotVersionID  string
+}
+
+func (gcp terraformGCP) GenerateTerraformConfig() []byte {
+	f := hclwrite.NewEmptyFile()
+	rootBody := f.Body()
+
+	providerBlock := rootBody.AppendNewBlock("provider", []string{"google"})
+	providerBody := providerBlock.Body()
+	providerBody.SetAttributeValue("project", cty.StringVal(gcp.Project))
+	providerBody.SetAttributeValue("region", cty.StringVal(gcp.Region))
+	providerBody.SetAttributeValue("zone", cty.StringVal(gcp.Zone))
+
+	addressBlock := rootBody.AppendNewBlock("resource", []string{"google_compute_address", "darknode"})
+	addressBody := addressBlock.Body()
+	addressBody.SetAttributeValue("name", cty.StringVal(fmt.Sprintf("darknode-ip-%v", gcp.Name)))
+
+	firewallBlock := rootBody.AppendNewBlock("resource", []string{"google_compute_firewall", "darknode"})
+	firewallBody := firewallBlock.Body()
+	firewallBody.SetAttributeValue("name", cty.StringVal(fmt.Sprintf("darknode-fw-%v", gcp.Name)))
+	firewallBody.SetAttributeValue("description", cty.StringVal("Allow inbound SSH and REN project traffic"))
+	firewallBody.SetAttributeValue("network", cty.StringVal("default"))
+	allowBlock := firewallBody.AppendNewBlock("allow", nil)
+	allowBody := allowBlock.Body()
+	allowBody.SetAttributeValue("protocol", cty.StringVal("tcp"))
+	allowBody.SetAttributeValue("ports", cty.ListVal([]cty.Value{cty.StringVal("22"), cty.StringVal("18514-18515")}))
+	firewallBody.SetAttributeValue("source_ranges", cty.ListVal([]cty.Value{cty.StringVal("0.0.0.0/0")}))
+	firewallBody.SetAttributeValue("target_tags", cty.ListVal([]cty.Value{cty.StringVal(fmt.Sprintf("darknode-%v", gcp.Name))}))
+
+	diskBlock := rootBody.AppendNewBlock("resource", []string{"google_compute_disk", "darknode"})
+	diskBody := diskBlock.Body()
+	diskBody.SetAttributeValue("name", cty.StringVal(fmt.Sprintf("darknode-disk-%v", gcp.Name)))
+	diskBody.SetAttributeValue("type", cty.StringVal(gcp.DiskType))
+	diskBody.SetAttributeValue("zone", cty.StringVal(gcp.Zone))
+	diskBody.SetAttributeValue("image", cty.StringVal("ubuntu-os-cloud/ubuntu-2004-lts"))
+	diskBody.SetAttributeValue("size", cty.NumberIntVal(int64(gcp.DiskSize)))
+
+	instanceBlock := rootBody.AppendNewBlock("resource", []string{"google_compute_instance", "darknode"})
+	instanceBody := instanceBlock.Body()
+	instanceBody.SetAttributeValue("name", cty.StringVal(gcp.Name))
+	instanceBody.SetAttributeValue("machine_type", cty.StringVal(gcp.MachineType))
+	instanceBody.SetAttributeValue("zone", cty.StringVal(gcp.Zone))
+	instanceBody.SetAttributeValue("allow_stopping_for_update", cty.True)
+	instanceBody.SetAttributeValue("tags", cty.ListVal([]cty.Value{cty.StringVal(fmt.Sprintf("darknode-%v", gcp.Name))}))
+
+	bootDiskBlock := instanceBody.AppendNewBlock("boot_disk", nil)
+	bootDiskBlock.Body().SetAttributeTraversal("source", hcl.Traversal{
+		hcl.TraverseRoot{
+			Name: "google_compute_disk",
+		},
+		hcl.TraverseAttr{
+			Name: "darknode",
+		},
+		hcl.TraverseAttr{
+			Name: "self_link",
+		},
+	})
+
+	networkBlock := instanceBody.AppendNewBlock("network_interface", nil)
+	networkBody := networkBlock.Body()
+	networkBody.SetAttributeValue("network", cty.StringVal("default"))
+	accessConfigBlock := networkBody.AppendNewBlock("access_config", nil)
+	accessConfigBlock.Body().SetAttributeTraversal("nat_ip", hcl.Traversal{
+		hcl.TraverseRoot{
+			Name: "google_compute_address",
+		},
+		hcl.TraverseAttr{
+			Name: "darknode",
+		},
+		hcl.TraverseAttr{
+			Name: "address",
+		},
+	})
+
+	metadata := fmt.Sprintf("{\n    ssh-keys = \"ubuntu:${file(\"%v\")}\"\n  }", gcp.PubKeyPath)
+	instanceBody.AppendUnstructuredTokens(unstructuredAttr("metadata", metadata))
+	instanceBody.AppendNewline()
+
+	remoteExecBlock := instanceBody.AppendNewBlock("provisioner", []string{"remote-exec"})
+	remoteExecBody := remoteExecBlock.Body()
+	remoteExecBody.SetAttributeValue("inline", cty.ListVal([]cty.Value{
+		cty.StringVal("set -x"),
+		cty.StringVal("until sudo apt update; do sleep 4; done"),
+		cty.StringVal("sudo adduser darknode --gecos \",,,\" --disabled-password"),
+		cty.StringVal("sudo rsync --archive --chown=darknode:darknode ~/.ssh /home/darknode"),
+		cty.StringVal("sudo DEBIAN_FRONTEND=noninteractive apt-get -y update"),
+		cty.StringVal("sudo DEBIAN_FRONTEND=noninteractive apt-get -y upgrade"),
+		cty.StringVal("sudo DEBIAN_FRONTEND=noninteractive apt-get -y dist-upgrade"),
+		cty.StringVal("sudo DEBIAN_FRONTEND=noninteractive apt-get -y autoremove"),
+		cty.StringVal("until sudo apt-get install -y ufw build-essential libhwloc-dev; do sleep 4; done"),
+		cty.StringVal("sudo ufw allow 22/tcp"),
+		cty.StringVal("sudo ufw allow 18514/tcp"),
+		cty.StringVal("sudo ufw allow 18515/tcp"),
+		cty.StringVal("sudo ufw --force enable"),
+		cty.StringVal("wget https://github.com/CosmWasm/wasmvm/archive/v0.16.1.tar.gz"),
+		cty.StringVal("tar -xzf v0.16.1.tar.gz"),
+		cty.StringVal("cd wasmvm-0.16.1/"),
+		cty.StringVal("sudo cp ./api/libwasmvm.so /usr/lib/"),
+		cty.StringVal("cd .."),
+		cty.StringVal("rm -r v0.16.1.tar.gz wasmvm-0.16.1"),
+	}))
+
+	host := unstructuredAttr("host", "self.network_interface.0.access_config.0.nat_ip")
+	key := hclwrite.Tokens{
+		&hclwrite.Token{
+			Type:         hclsyntax.TokenStringLit,
+			Bytes:        []byte("private_key "),
+			SpacesBefore: 0,
+		},
+		&hclwrite.Token{
+			Type:         hclsyntax.TokenEqual,
+			Bytes:        []byte("="),
+			SpacesBefore: 0,
+		},
+		&hclwrite.Token{
+			Type:         hclsyntax.TokenStringLit,
+			Bytes:        []byte(" file"),
+			SpacesBefore: 0,
+		},
+		&hclwrite.Token{
+			Type:         hclsyntax.TokenOParen,
+			Bytes:        []byte("("),
+			SpacesBefore: 0,
+		},
+		&hclwrite.Token{
+			Type:         hclsyntax.TokenStringLit,
+			Bytes:        []byte(fmt.Sprintf("\"%v\"", gcp.PriKeyPath)),
+			SpacesBefore: 0,
+		},
+		&hclwrite.Token{
+			Type:         hclsyntax.TokenCParen,
+			Bytes:        []byte(")"),
+			SpacesBefore: 0,
+		},
+	}
+	remoteConnectionBlock := remoteExecBody.AppendNewBlock("connection", nil)
+	remoteConnectionBody := remoteConnectionBlock.Body()
+	remoteConnectionBody.AppendUnstructuredTokens(host)
+	remoteConnectionBody.AppendNewline()
+	remoteConnectionBody.SetAttributeValue("type", cty.StringVal("ssh"))
+	remoteConnectionBody.SetAttributeValue("user", cty.StringVal("ubuntu"))
+	remoteConnectionBody.AppendUnstructuredTokens(key)
+	remoteConnectionBody.AppendNewline()
+
+	serviceFileBlock := instanceBody.AppendNewBlock("provisioner", []string{"file"})
+	serviceFileBody := serviceFileBlock.Body()
+	serviceFileBody.SetAttributeValue("source", cty.StringVal(gcp.ServiceFile))
+	serviceFileBody.SetAttributeValue("destination", cty.StringVal("/home/darknode/darknode.service"))
+	serviceConnectionBlock := serviceFileBody.AppendNewBlock("connection", nil)
+	serviceConnectionBody := serviceConnectionBlock.Body()
+	serviceConnectionBody.AppendUnstructuredTokens(host)
+	serviceConnectionBody.AppendNewline()
+	serviceConnectionBody.SetAttributeValue("type", cty.StringVal("ssh"))
+	serviceConnectionBody.SetAttributeValue("user", cty.StringVal("darknode"))
+	serviceConnectionBody.AppendUnstructuredTokens(key)
+	serviceConnectionBody.AppendNewline()
+
+	updaterServiceFileBlock := instanceBody.AppendNewBlock("provisioner", []string{"file"})
+	updaterServiceFileBody := updaterServiceFileBlock.Body()
+	updaterServiceFileBody.SetAttributeValue("source", cty.StringVal(gcp.UpdaterServiceFile))
+	updaterServiceFileBody.SetAttributeValue("destination", cty.StringVal("/home/darknode/darknode-updater.service"))
+	updaterServiceConnectionBlock := updaterServiceFileBody.AppendNewBlock("connection", nil)
+	updaterServiceConnectionBody := updaterServiceConnectionBlock.Body()
+	updaterServiceConnectionBody.AppendUnstructuredTokens(host)
+	updaterServiceConnectionBody.AppendNewline()
+	updaterServiceConnectionBody.SetAttributeValue("type", cty.StringVal("ssh"))
+	updaterServiceConnectionBody.SetAttributeValue("user", cty.StringVal("darknode"))
+	updaterServiceConnectionBody.AppendUnstructuredTokens(key)
+	updaterServiceConnectionBody.AppendNewline()
+
+	snapshotURL := gcp.Source.FileURL(gcp.Network, util.LatestSnapshot)
+	remoteExec2Block := instanceBody.AppendNewBlock("provisioner", []string{"remote-exec"})
+	remoteExec2Body := remoteExec2Block.Body()
+	remoteExec2Body.SetAttributeValue("inline", cty.ListVal([]cty.Value{
+		cty.StringVal("set -x"),
+		cty.StringVal("mkdir -p $HOME/.darknode/bin"),
+		cty.StringVal("mkdir -p $HOME/.config/systemd/user"),
+		cty.StringVal(fmt.Sprintf("cd .darknode && curl -sSOJL %v && tar xzf latest.tar.gz", util.ShellQuote(snapshotURL))),
+		cty.StringVal("rm latest.tar.gz"),
+		cty.StringVal("mv $HOME/darknode.service $HOME/.config/systemd/user/darknode.service"),
+		cty.StringVal("mv $HOME/darknode-updater.service $HOME/.config/systemd/user/darknode-updater.service"),
+		cty.StringVal(fmt.Sprintf("curl -sL %v > ~/.darknode/bin/darknode", util.ShellQuote(gcp.Source.BinaryURL(gcp.Version)))),
+		cty.StringVal(util.VerifyChecksumScript("$HOME/.darknode/bin/darknode", gcp.Checksum)),
+		cty.StringVal(fmt.Sprintf("curl -sL %v > ~/.darknode/bin/darknode-updater", util.ShellQuote(gcp.Source.UpdaterURL()))),
+		cty.StringVal("chmod +x ~/.darknode/bin/darknode"),
+		cty.StringVal("chmod +x ~/.darknode/bin/darknode-updater"),
+		cty.StringVal("loginctl enable-linger darknode"),
+		cty.StringVal("systemctl --user enable darknode.service"),
+		cty.StringVal("systemctl --user enable darknode-updater.service"),
+		cty.StringVal("systemctl --user start darknode-updater"),
+		cty.StringVal(fmt.Sprintf("echo 'DARKNODE_SNAPSHOT_VERSIONID=%v' >> .env", gcp.SnapshotVersionID)),
+		cty.StringVal(fmt.Sprintf("echo 'DARKNODE_CONFIG_VERSIONID=%v' >> .env", gcp.ConfigVersionID)),
+		cty.StringVal(fmt.Sprintf("echo 'DARKNODE_INSTALLED=%v' >> .env", gcp.Version)),
+		cty.StringVal(fmt.Sprintf("echo ARTIFACT_SOURCE=%v >> .env", util.ShellQuote(gcp.Source.String()))),
+		cty.StringVal("echo 'UPDATE_BIN=1' >> .env"),
+		cty.StringVal("echo 'UPDATE_CONFIG=1' >> .env"),
+		cty.StringVal("echo 'UPDATE_RECOVERY=1' >> .env"),
+	}))
+
+	remoteConnection2Block := remoteExec2Body.AppendNewBlock("connection", nil)
+	remoteConnection2Body := remoteConnection2Block.Body()
+	remoteConnection2Body.AppendUnstructuredTokens(host)
+	remoteConnection2Body.AppendNewline()
+	remoteConnection2Body.SetAttributeValue("type", cty.StringVal("ssh"))
+	remoteConnection2Body.SetAttributeValue("user", cty.StringVal("darknode"))
+	remoteConnection2Body.AppendUnstructuredTokens(key)
+	remoteConnection2Body.AppendNewline()
+
+	outputProviderBlock := rootBody.AppendNewBlock("output", []string{"provider"})
+	outputProviderBody := outputProviderBlock.Body()
+	outputProviderBody.SetAttributeValue("value", cty.StringVal("gcp"))
+
+	outputIPBlock := rootBody.AppendNewBlock("output", []string{"ip"})
+	outputIPBody := outputIPBlock.Body()
+	outputIPBody.SetAttributeTraversal("value", hcl.Traversal{
+		hcl.TraverseRoot{
+			Name: "google_compute_address",
+		},
+		hcl.TraverseAttr{
+			Name: "darknode",
+		},
+		hcl.TraverseAttr{
+			Name: "address",
+		},
+	})
+
+	return f.Bytes()
+}
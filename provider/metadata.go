@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/renproject/multichain"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// writeMetadata records the metadata of a newly deployed node. Provider
+// specific fields are expected to be filled by the caller.
+func writeMetadata(ctx *cli.Context, meta util.NodeMetadata) error {
+	meta.Name = ctx.String("name")
+	meta.Network = multichain.Network(ctx.String("network"))
+	meta.Tags = util.ParseTags(ctx.String("tags"))
+	meta.User = "darknode"
+	meta.CreatedAt = time.Now().UTC()
+	if meta.IP == "" {
+		ip, err := util.TerraformOutput(meta.Name, "ip")
+		if err != nil {
+			return err
+		}
+		meta.IP = ip
+	}
+	return util.WriteNodeMetadata(meta)
+}
+
+// ReconcileMetadata rebuilds the metadata of the node with given name from its
+// terraform state and files. Fields which cannot be derived from them, like the
+// version and the creation time, are kept from the existing metadata.
+func ReconcileMetadata(name string) (util.NodeMetadata, error) {
+	if err := util.NodeExistence(name); err != nil {
+		return util.NodeMetadata{}, err
+	}
+	meta, err := util.ReadNodeMetadata(name)
+	migrated := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return util.NodeMetadata{}, err
+	}
+	meta.Name = name
+
+	// Terraform state is the source of truth of the deployed resources
+	if meta.Provider, err = util.TerraformOutput(name, "provider"); err != nil {
+		return util.NodeMetadata{}, err
+	}
+	if meta.IP, err = util.TerraformOutput(name, "ip"); err != nil {
+		return util.NodeMetadata{}, err
+	}
+	meta.User = "darknode"
+	if user, err := util.TerraformOutput(name, "instance_user"); err == nil {
+		meta.User = user
+	}
+	if meta.Region, meta.Instance, err = nodeRegionAndInstance(name, meta.Provider); err != nil {
+		return util.NodeMetadata{}, err
+	}
+	switch meta.Provider {
+	case NameAws, NameGcp:
+		meta.SudoUser = "ubuntu"
+	case NameSSH:
+		if meta.SudoUser, err = util.TerraformOutput(name, "sudo_user"); err != nil {
+			return util.NodeMetadata{}, err
+		}
+	default:
+		meta.SudoUser = "root"
+	}
+
+	// Details which are kept locally
+	options, err := util.NodeOptions(name)
+	if err != nil {
+		return util.NodeMetadata{}, err
+	}
+	meta.Network = options.Network
+	if !migrated {
+		tags, err := util.NodeTags(name)
+		if err != nil && !os.IsNotExist(err) {
+			return util.NodeMetadata{}, err
+		}
+		meta.Tags = util.ParseTags(tags)
+	}
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+	if meta.CreatedAt.IsZero() {
+		configPath := util.NodeConfigPath(name)
+		if util.NodeConfigEncrypted(name) {
+			configPath = util.NodeEncryptedConfigPath(name)
+		}
+		info, err := os.Stat(configPath)
+		if err != nil {
+			return util.NodeMetadata{}, err
+		}
+		meta.CreatedAt = info.ModTime().UTC()
+	}
+
+	// The installed version can only be found on the instance
+	if meta.Version == "" {
+		script := "grep DARKNODE_INSTALLED $HOME/.darknode/.env | tail -1 | cut -d= -f2"
+		output, err := util.RemoteOutput(name, script)
+		if err != nil {
+			color.Yellow("cannot read the installed version of [%v], err = %v", name, err)
+		} else {
+			meta.Version = strings.Trim(strings.TrimSpace(string(output)), "\"'")
+		}
+	}
+
+	return meta, util.WriteNodeMetadata(meta)
+}
+
+// nodeRegionAndInstance reads the region and instance type of the node from
+// its terraform config.
+func nodeRegionAndInstance(name, provider string) (string, string, error) {
+	var region, instance cty.Value
+	var config map[string]string
+	var err error
+	switch provider {
+	case NameAws:
+		if config, err = terraformProviderConfig(name, "aws"); err != nil {
+			return "", "", err
+		}
+		region = cty.StringVal(config["region"])
+		instance, err = terraformAttribute(name, "aws_instance", "darknode", "instance_type")
+	case NameDo:
+		if region, err = terraformAttribute(name, "digitalocean_droplet", "darknode", "region"); err != nil {
+			return "", "", err
+		}
+		instance, err = terraformAttribute(name, "digitalocean_droplet", "darknode", "size")
+	case NameGcp:
+		if config, err = terraformProviderConfig(name, "google"); err != nil {
+			return "", "", err
+		}
+		region = cty.StringVal(config["region"])
+		instance, err = terraformAttribute(name, "google_compute_instance", "darknode", "machine_type")
+	case NameSSH:
+		return "", "", nil
+	default:
+		return "", "", ErrUnknownProvider
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if region.Type() != cty.String || instance.Type() != cty.String {
+		return "", "", fmt.Errorf("cannot read region and instance type of [%v]", name)
+	}
+	return region.AsString(), instance.AsString(), nil
+}
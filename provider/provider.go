@@ -4,15 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/renproject/multichain"
 	"github.com/renproject/nodectl/renvm"
 	"github.com/renproject/nodectl/util"
 	"github.com/urfave/cli/v2"
+	"github.com/zclconf/go-cty/cty"
 )
 
 const MaxNameLength = 32
@@ -70,6 +72,8 @@ var (
 
 	ErrInsufficientPermission = errors.New("insufficient permissions")
 
+	ErrInstanceNotFound = errors.New("cannot find the instance of the darknode")
+
 	ErrInvalidNodeNameForGCP = errors.New("for google cloud, name must start with a lowercase letter followed by up to 62 lowercase letters, numbers, or hyphens, and cannot end with a hyphen")
 )
 
@@ -77,6 +81,7 @@ var (
 	NameAws = "aws"
 	NameDo  = "do"
 	NameGcp = "gcp"
+	NameSSH = "ssh"
 )
 
 type Provider interface {
@@ -86,6 +91,21 @@ type Provider interface {
 
 	// Deploy darknode with from this provider
 	Deploy(ctx *cli.Context) error
+
+	// Destroy the darknode with given name and release all the resources
+	// allocated for it
+	Destroy(name string) error
+
+	// Status returns the state of the instance which hosts the darknode with
+	// given name
+	Status(name string) (string, error)
+
+	// Resize changes the instance type of the darknode with given name
+	Resize(name, size string) error
+
+	// GrowDisk expands the disk of the darknode with given name to the given
+	// size in GB, along with the filesystem on it
+	GrowDisk(name string, size int) error
 }
 
 // ParseProvider parses the cloud provider from input arguments.
@@ -96,10 +116,37 @@ func ParseProvider(ctx *cli.Context) (Provider, error) {
 	if ctx.Bool(NameDo) {
 		return NewDo(ctx)
 	}
+	if ctx.Bool(NameGcp) {
+		return NewGCP(ctx)
+	}
+	if ctx.Bool(NameSSH) {
+		return NewSSH(ctx)
+	}
 
 	return nil, ErrUnknownProvider
 }
 
+// ParseNodeProvider returns the cloud provider of the node with given name. The
+// provider is initialized with the credentials used to deploy the node.
+func ParseNodeProvider(name string) (Provider, error) {
+	p, err := util.NodeProvider(name)
+	if err != nil {
+		return nil, err
+	}
+	switch p {
+	case NameAws:
+		return newAWSFromNode(name)
+	case NameDo:
+		return newDoFromNode(name)
+	case NameGcp:
+		return newGCPFromNode(name)
+	case NameSSH:
+		return newSSHFromNode(name)
+	default:
+		return nil, ErrUnknownProvider
+	}
+}
+
 // ParseNetwork parses the network from input arguments.
 func ParseNetwork(ctx *cli.Context) (multichain.Network, error) {
 	network := multichain.Network(ctx.String("network"))
@@ -125,12 +172,35 @@ func NodeSudoUsername(name string) (string, error) {
 		username = "ubuntu"
 	case NameDo:
 		username = "root"
+	case NameGcp:
+		username = "ubuntu"
+	case NameSSH:
+		meta, err := util.ReadNodeMetadata(name)
+		if err == nil && meta.SudoUser != "" {
+			return meta.SudoUser, nil
+		}
+		username, err = util.TerraformOutput(name, "sudo_user")
+		if err != nil {
+			return "", err
+		}
 	default:
 		username = "root"
 	}
 	return username, nil
 }
 
+// validateDiskGrowth checks the new disk size is larger than the current one.
+func validateDiskGrowth(current cty.Value, size int) error {
+	if current.Type() != cty.Number {
+		return errors.New("cannot read current disk size")
+	}
+	currentSize, _ := current.AsBigFloat().Int64()
+	if int64(size) <= currentSize {
+		return fmt.Errorf("new disk size must be larger than the current size %vGB", currentSize)
+	}
+	return nil
+}
+
 // Validate the params which are general to all providers.
 func validateCommonParams(ctx *cli.Context) error {
 	// Check the name valida and not been used
@@ -148,6 +218,14 @@ func validateCommonParams(ctx *cli.Context) error {
 		return err
 	}
 
+	// Unlock the keystore before creating any resource if the config needs
+	// to be encrypted
+	if ctx.Bool("encrypt") {
+		if _, err := util.Passphrase(true); err != nil {
+			return err
+		}
+	}
+
 	// Verify the config file if user wants to use their own config
 	configFile := ctx.String("config")
 	if configFile != "" {
@@ -198,20 +276,42 @@ func initialize(ctx *cli.Context) error {
 	return ioutil.WriteFile(updaterServicePath, []byte(DarknodeUpdaterService), 0600)
 }
 
+// writeNodeOptions writes the config of the new node, which is encrypted if the
+// user asks for it.
+func writeNodeOptions(ctx *cli.Context, options renvm.Options) error {
+	name := ctx.String("name")
+	if ctx.Bool("encrypt") {
+		return util.EncryptNodeOptions(name, options)
+	}
+	return util.WriteNodeOptions(name, options)
+}
+
 func applyTerraform(name string) error {
-	init := fmt.Sprintf("cd %v && %v init", util.NodePath(name), util.Terraform)
-	if err := util.Run("bash", "-c", init); err != nil {
+	if err := runTerraform(name, "init"); err != nil {
 		return err
 	}
-	apply := fmt.Sprintf("cd %v && %v apply -auto-approve -no-color", util.NodePath(name), util.Terraform)
-	return util.Run("bash", "-c", apply)
+	return runTerraform(name, "apply", "-auto-approve", "-no-color")
 }
 
-func fileVersionID(key string) (string, error) {
-	response, err := http.Head(fmt.Sprintf("https://s3.ap-southeast-1.amazonaws.com/darknode.renproject.io/%v", key))
-	if err != nil {
-		return "", err
+// unstructuredAttr returns the tokens of an attribute whose value is a raw
+// expression, i.e. a function call or a template, which cannot be represented
+// as a cty value.
+func unstructuredAttr(name, expr string) hclwrite.Tokens {
+	return hclwrite.Tokens{
+		&hclwrite.Token{
+			Type:         hclsyntax.TokenStringLit,
+			Bytes:        []byte(name + " "),
+			SpacesBefore: 0,
+		},
+		&hclwrite.Token{
+			Type:         hclsyntax.TokenEqual,
+			Bytes:        []byte("="),
+			SpacesBefore: 0,
+		},
+		&hclwrite.Token{
+			Type:         hclsyntax.TokenStringLit,
+			Bytes:        []byte(" " + expr),
+			SpacesBefore: 0,
+		},
 	}
-	defer response.Body.Close()
-	return response.Header.Get("x-amz-version-id"), nil
 }
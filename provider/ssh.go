@@ -0,0 +1,340 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/renproject/aw/wire"
+	"github.com/renproject/multichain"
+	"github.com/renproject/nodectl/renvm"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/crypto/ssh"
+)
+
+const DefaultSSHUser = "root"
+
+type providerSSH struct {
+	ip      string
+	user    string
+	keyPath string
+}
+
+// NewSSH creates a provider which adopts an existing server that can be
+// reached through SSH.
+func NewSSH(ctx *cli.Context) (Provider, error) {
+	ip := strings.TrimSpace(ctx.String("ssh-ip"))
+	user := strings.TrimSpace(ctx.String("ssh-user"))
+	keyPath := strings.TrimSpace(ctx.String("ssh-key"))
+	if ip == "" || keyPath == "" {
+		return nil, ErrMissingCredential
+	}
+	if net.ParseIP(ip) == nil {
+		return nil, fmt.Errorf("invalid ip address [%v]", ip)
+	}
+	if user == "" {
+		return nil, errors.New("sudo user cannot be empty")
+	}
+
+	// Make sure we can use the private key without interactive prompts
+	keyPath, err := filepath.Abs(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read private key, err = %v", err)
+	}
+	if _, err := ssh.ParsePrivateKey(key); err != nil {
+		return nil, fmt.Errorf("invalid private key, err = %v", err)
+	}
+
+	return providerSSH{
+		ip:      ip,
+		user:    user,
+		keyPath: keyPath,
+	}, nil
+}
+
+// newSSHFromNode creates a provider for the existing server which hosts the
+// node with given name.
+func newSSHFromNode(name string) (Provider, error) {
+	ip, err := util.NodeIP(name)
+	if err != nil {
+		return nil, err
+	}
+	user, err := NodeSudoUsername(name)
+	if err != nil {
+		return nil, err
+	}
+	return providerSSH{
+		ip:      ip,
+		user:    user,
+		keyPath: filepath.Join(util.NodePath(name), "ssh_keypair"),
+	}, nil
+}
+
+// Name implements the `Provider` interface
+func (p providerSSH) Name() string {
+	return NameSSH
+}
+
+// Deploy implements the `Provider` interface
+func (p providerSSH) Deploy(ctx *cli.Context) error {
+	// Validate all input params
+	if err := validateCommonParams(ctx); err != nil {
+		return err
+	}
+	source, err := util.ParseArtifactSource(ctx.String("artifact-source"))
+	if err != nil {
+		return err
+	}
+	name := ctx.String("name")
+	network := multichain.Network(ctx.String("network"))
+
+	// Fetch the remote config template
+	templateOpts, err := util.OptionTemplate(source, network)
+	if err != nil {
+		return err
+	}
+
+	// Get the latest darknode version
+	version, err := source.LatestRelease(network)
+	if err != nil {
+		return err
+	}
+	checksum, err := source.BinaryChecksum(version)
+	if err != nil {
+		return err
+	}
+
+	// Initialize folder and files for the node
+	if err := initialize(ctx); err != nil {
+		return err
+	}
+
+	// Replace the generated ssh keys with the one which has access to the server
+	if err := p.copyKeypair(name); err != nil {
+		return err
+	}
+
+	// Get file version ID
+	configVersionID, err := source.VersionID(network, "config.json")
+	if err != nil {
+		return err
+	}
+	snapshotVersionID, err := source.VersionID(network, util.LatestSnapshot)
+	if err != nil {
+		return err
+	}
+
+	// Terraform only keeps track of the node details, so the node can be
+	// managed the same way as the others.
+	tf := terraformSSH{
+		IP:       p.ip,
+		SudoUser: p.user,
+	}
+	tfData := tf.GenerateTerraformConfig()
+	tfFile, err := os.Create(filepath.Join(util.NodePath(name), "main.tf"))
+	if err != nil {
+		return err
+	}
+	if _, err := tfFile.Write(tfData); err != nil {
+		return err
+	}
+	if err := applyTerraform(name); err != nil {
+		return err
+	}
+	meta := util.NodeMetadata{
+		Provider:       NameSSH,
+		IP:             p.ip,
+		SudoUser:       p.user,
+		Version:        version,
+		ArtifactSource: source.String(),
+	}
+	if err := writeMetadata(ctx, meta); err != nil {
+		return err
+	}
+
+	// Install everything needed by the darknode
+	color.Green("Setting up the server...")
+	if err := util.RemoteRun(name, strings.Join(p.setupScript(), " && "), p.user); err != nil {
+		return fmt.Errorf("cannot setup the server, err = %v", err)
+	}
+	installScript := sshInstallScript(source, network, version, checksum, configVersionID, snapshotVersionID)
+	if err := util.RemoteRun(name, strings.Join(installScript, " && "), "darknode"); err != nil {
+		return fmt.Errorf("cannot install darknode, err = %v", err)
+	}
+
+	// Generate the config file using the ip address and template
+	opts := renvm.NewOptions(network)
+	ip := fmt.Sprintf("%v:18514", p.ip)
+	addr := wire.NewUnsignedAddress(wire.TCP, ip, uint64(time.Now().UnixNano()))
+	if err := addr.Sign(opts.PrivKey); err != nil {
+		return fmt.Errorf("cannot sign address: %v", err)
+	}
+	opts.Peers = append([]wire.Address{addr}, templateOpts.Peers...)
+	opts.Selectors = templateOpts.Selectors
+	opts.Chains = templateOpts.Chains
+	opts.Whitelist = templateOpts.Whitelist
+	if err := writeNodeOptions(ctx, opts); err != nil {
+		return err
+	}
+
+	// Upload the config file to remote instance
+	data, err := json.MarshalIndent(opts, "", "    ")
+	if err != nil {
+		return err
+	}
+	copyConfig := fmt.Sprintf("echo '%s' > $HOME/.darknode/config.json", string(data))
+	if err := util.RemoteRun(name, copyConfig, "darknode"); err != nil {
+		return err
+	}
+
+	// Start the darknode service
+	startService := "systemctl --user start darknode"
+	if err := util.RemoteRun(name, startService, "darknode"); err != nil {
+		return err
+	}
+
+	color.Green("Your darknode is up and running")
+	return nil
+}
+
+// Destroy implements the `Provider` interface. The server is not owned by
+// nodectl, so we only stop the darknode services and leave the server running.
+func (p providerSSH) Destroy(name string) error {
+	script := "systemctl --user disable --now darknode-updater darknode"
+	if err := util.RemoteRun(name, script, "darknode"); err != nil {
+		color.Yellow("cannot stop darknode services on %v, err = %v", p.ip, err)
+	}
+	return destroyTerraform(name)
+}
+
+// Status implements the `Provider` interface
+func (p providerSSH) Status(name string) (string, error) {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%v:22", p.ip), 10*time.Second)
+	if err != nil {
+		return "unreachable", nil
+	}
+	conn.Close()
+	return "reachable", nil
+}
+
+// Resize implements the `Provider` interface
+func (p providerSSH) Resize(name, size string) error {
+	return errors.New("resizing is not supported for existing servers")
+}
+
+// GrowDisk implements the `Provider` interface
+func (p providerSSH) GrowDisk(name string, size int) error {
+	return errors.New("growing disk is not supported for existing servers")
+}
+
+// copyKeypair overwrites the ssh keypair of the node with the private key
+// given by the user.
+func (p providerSSH) copyKeypair(name string) error {
+	key, err := ioutil.ReadFile(p.keyPath)
+	if err != nil {
+		return err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return err
+	}
+	priKeyPath := filepath.Join(util.NodePath(name), "ssh_keypair")
+	if err := ioutil.WriteFile(priKeyPath, key, 0600); err != nil {
+		return err
+	}
+	pubKeyPath := filepath.Join(util.NodePath(name), "ssh_keypair.pub")
+	return ioutil.WriteFile(pubKeyPath, ssh.MarshalAuthorizedKey(signer.PublicKey()), 0600)
+}
+
+// setupScript returns the commands which need to be run by the sudo user. They
+// are the same as what we do for the cloud instances.
+func (p providerSSH) setupScript() []string {
+	return []string{
+		"set -x",
+		"until sudo apt update; do sleep 4; done",
+		"(id -u darknode || sudo adduser darknode --gecos \",,,\" --disabled-password)",
+		"sudo rsync --archive --chown=darknode:darknode ~/.ssh /home/darknode",
+		"sudo DEBIAN_FRONTEND=noninteractive apt-get -y update",
+		"until sudo apt-get install -y ufw build-essential libhwloc-dev; do sleep 4; done",
+		"sudo ufw allow 22/tcp",
+		"sudo ufw allow 18514/tcp",
+		"sudo ufw allow 18515/tcp",
+		"sudo ufw --force enable",
+		"wget -q https://github.com/CosmWasm/wasmvm/archive/v0.16.1.tar.gz",
+		"tar -xzf v0.16.1.tar.gz",
+		"sudo cp ./wasmvm-0.16.1/api/libwasmvm.so /usr/lib/",
+		"rm -r v0.16.1.tar.gz wasmvm-0.16.1",
+	}
+}
+
+// sshInstallScript returns the commands which need to be run by the darknode
+// user to install the darknode and the updater.
+func sshInstallScript(source util.ArtifactSource, network multichain.Network, version, checksum, configVersionID, snapshotVersionID string) []string {
+	snapshotURL := source.FileURL(network, util.LatestSnapshot)
+	return []string{
+		"set -x",
+		"mkdir -p $HOME/.darknode/bin",
+		"mkdir -p $HOME/.config/systemd/user",
+		fmt.Sprintf("cd $HOME/.darknode && curl -sSOJL %v && tar xzf latest.tar.gz", util.ShellQuote(snapshotURL)),
+		"rm $HOME/.darknode/latest.tar.gz",
+		fmt.Sprintf("echo '%v' > $HOME/.config/systemd/user/darknode.service", DarknodeService),
+		fmt.Sprintf("echo '%v' > $HOME/.config/systemd/user/darknode-updater.service", DarknodeUpdaterService),
+		fmt.Sprintf("curl -sL %v > ~/.darknode/bin/darknode", util.ShellQuote(source.BinaryURL(version))),
+		util.VerifyChecksumScript("$HOME/.darknode/bin/darknode", checksum),
+		fmt.Sprintf("curl -sL %v > ~/.darknode/bin/darknode-updater", util.ShellQuote(source.UpdaterURL())),
+		"chmod +x ~/.darknode/bin/darknode",
+		"chmod +x ~/.darknode/bin/darknode-updater",
+		"loginctl enable-linger darknode",
+		"systemctl --user daemon-reload",
+		"systemctl --user enable darknode.service",
+		"systemctl --user enable darknode-updater.service",
+		"systemctl --user start darknode-updater",
+		fmt.Sprintf("echo 'DARKNODE_SNAPSHOT_VERSIONID=%v' >> $HOME/.darknode/.env", snapshotVersionID),
+		fmt.Sprintf("echo 'DARKNODE_CONFIG_VERSIONID=%v' >> $HOME/.darknode/.env", configVersionID),
+		fmt.Sprintf("echo 'DARKNODE_INSTALLED=%v' >> $HOME/.darknode/.env", version),
+		fmt.Sprintf("echo ARTIFACT_SOURCE=%v >> $HOME/.darknode/.env", util.ShellQuote(source.String())),
+		"echo 'UPDATE_BIN=1' >> $HOME/.darknode/.env",
+		"echo 'UPDATE_CONFIG=1' >> $HOME/.darknode/.env",
+		"echo 'UPDATE_RECOVERY=1' >> $HOME/.darknode/.env",
+	}
+}
+
+// terraformSSH does not manage any resource. It only records the outputs which
+// other commands rely on.
+type terraformSSH struct {
+	IP       string
+	SudoUser string
+}
+
+func (s terraformSSH) GenerateTerraformConfig() []byte {
+	f := hclwrite.NewEmptyFile()
+	rootBody := f.Body()
+
+	outputProviderBlock := rootBody.AppendNewBlock("output", []string{"provider"})
+	outputProviderBody := outputProviderBlock.Body()
+	outputProviderBody.SetAttributeValue("value", cty.StringVal(NameSSH))
+
+	outputIPBlock := rootBody.AppendNewBlock("output", []string{"ip"})
+	outputIPBody := outputIPBlock.Body()
+	outputIPBody.SetAttributeValue("value", cty.StringVal(s.IP))
+
+	outputUserBlock := rootBody.AppendNewBlock("output", []string{"sudo_user"})
+	outputUserBody := outputUserBlock.Body()
+	outputUserBody.SetAttributeValue("value", cty.StringVal(s.SudoUser))
+
+	return f.Bytes()
+}
@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/renproject/multichain"
+	"github.com/renproject/nodectl/util"
+)
+
+func TestSSHInstallScriptArtifactSource(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	specs := []string{
+		"https://mirror.example.com/it's",
+		"/srv/mirror $(touch pwned)",
+	}
+	for _, spec := range specs {
+		source, err := util.ParseArtifactSource(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		script := ""
+		for _, line := range sshInstallScript(source, multichain.NetworkTestnet, "0.4.10", "", "", "") {
+			if strings.Contains(line, "ARTIFACT_SOURCE") {
+				script = line
+			}
+		}
+		if script == "" {
+			t.Fatal("artifact source is not stored")
+		}
+
+		home := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(home, ".darknode"), 0700); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command("bash", "-c", script)
+		cmd.Env = []string{"HOME=" + home, "PATH=" + os.Getenv("PATH")}
+		cmd.Dir = home
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("cannot store %q, err = %v, output = %s", spec, err, output)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(home, ".darknode", ".env"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "ARTIFACT_SOURCE=" + source.String() + "\n"; string(data) != want {
+			t.Errorf("stored = %q, want %q", data, want)
+		}
+		if _, err := os.Stat(filepath.Join(home, "pwned")); !os.IsNotExist(err) {
+			t.Errorf("source %q is executed by the shell", spec)
+		}
+	}
+}
@@ -0,0 +1,465 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/renproject/nodectl/util"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ErrPlanDestroysResource is returned when applying the changes would destroy
+// some of the existing resources of the node.
+var ErrPlanDestroysResource = errors.New("the change would destroy existing resources of the darknode")
+
+// destroyTerraform tears down all the resources managed by terraform for the
+// node with given name.
+func destroyTerraform(name string) error {
+	return runTerraform(name, "destroy", "-auto-approve", "-no-color")
+}
+
+// terraformCommand returns the command which runs terraform with given args in
+// the folder of the node. The cloud credentials of the node are passed through
+// environment variables.
+func terraformCommand(name string, args ...string) (*exec.Cmd, error) {
+	creds, err := util.ReadNodeCredentials(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read credentials, err = %v", err)
+	}
+	env, err := terraformEnv(creds)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(util.Terraform, args...)
+	cmd.Dir = util.NodePath(name)
+	cmd.Env = append(os.Environ(), env...)
+	return cmd, nil
+}
+
+// runTerraform runs terraform with given args in the folder of the node and
+// pipes the output to the stdout.
+func runTerraform(name string, args ...string) error {
+	cmd, err := terraformCommand(name, args...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// terraformCredentialAttrs are the attributes of the provider blocks which hold
+// the cloud credentials. They are written by older versions of nodectl.
+var terraformCredentialAttrs = map[string][]string{
+	"aws":          {"access_key", "secret_key"},
+	"digitalocean": {"token"},
+	"google":       {"credentials"},
+}
+
+// terraformProviderName returns the name of the terraform provider used by the
+// node.
+func terraformProviderName(name string) (string, error) {
+	p, err := util.NodeProvider(name)
+	if err != nil {
+		return "", err
+	}
+	switch p {
+	case NameAws:
+		return "aws", nil
+	case NameDo:
+		return "digitalocean", nil
+	case NameGcp:
+		return "google", nil
+	default:
+		return "", nil
+	}
+}
+
+// terraformCredentials reads the credentials from the provider block of the
+// `main.tf` file of the node.
+func terraformCredentials(name string) (util.NodeCredentials, error) {
+	var creds util.NodeCredentials
+	provider, err := terraformProviderName(name)
+	if err != nil || provider == "" {
+		return creds, err
+	}
+	config, err := terraformProviderConfig(name, provider)
+	if err != nil {
+		return creds, err
+	}
+	creds.AwsAccessKey = config["access_key"]
+	creds.AwsSecretKey = config["secret_key"]
+	creds.DoToken = config["token"]
+	creds.GcpCredFile = config["credentials"]
+	return creds, nil
+}
+
+// nodeCredentials returns the cloud credentials of the node. Darknodes deployed
+// by an older version have the credentials in the `main.tf` file until they
+// are scrubbed.
+func nodeCredentials(name string) (util.NodeCredentials, error) {
+	creds, err := util.ReadNodeCredentials(name)
+	if err != nil || !creds.Empty() {
+		return creds, err
+	}
+	return terraformCredentials(name)
+}
+
+// ScrubCredentials moves the cloud credentials of the node from the `main.tf`
+// file to the credentials file outside the darknode folder. It returns false
+// if the `main.tf` file has no credentials.
+func ScrubCredentials(name string) (bool, error) {
+	provider, err := terraformProviderName(name)
+	if err != nil || provider == "" {
+		return false, err
+	}
+	creds, err := terraformCredentials(name)
+	if err != nil || creds.Empty() {
+		return false, err
+	}
+
+	// Save the credentials before removing them from the terraform file
+	if err := util.WriteNodeCredentials(name, creds); err != nil {
+		return false, err
+	}
+	path := filepath.Join(util.NodePath(name), "main.tf")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	file, diags := hclwrite.ParseConfig(data, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return false, diags
+	}
+	block := file.Body().FirstMatchingBlock("provider", []string{provider})
+	if block == nil {
+		return false, fmt.Errorf("cannot find %v provider in terraform file", provider)
+	}
+	for _, attr := range terraformCredentialAttrs[provider] {
+		block.Body().RemoveAttribute(attr)
+	}
+	return true, ioutil.WriteFile(path, file.Bytes(), 0600)
+}
+
+// terraformProviderConfig reads the attributes of the provider block from the
+// `main.tf` file of the node. Only string literals are returned, apart from
+// `file()` function calls which are resolved to the path of the file.
+func terraformProviderConfig(name, provider string) (map[string]string, error) {
+	path := filepath.Join(util.NodePath(name), "main.tf")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, diags := hclsyntax.ParseConfig(data, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("invalid terraform file")
+	}
+
+	for _, block := range body.Blocks {
+		if block.Type != "provider" || len(block.Labels) != 1 || block.Labels[0] != provider {
+			continue
+		}
+		attrs := map[string]string{}
+		for name, attr := range block.Body.Attributes {
+			expr := attr.Expr
+			if call, ok := expr.(*hclsyntax.FunctionCallExpr); ok && call.Name == "file" && len(call.Args) == 1 {
+				expr = call.Args[0]
+			}
+			value, diags := expr.Value(nil)
+			if diags.HasErrors() || value.Type() != cty.String || value.IsNull() {
+				continue
+			}
+			attrs[name] = value.AsString()
+		}
+		return attrs, nil
+	}
+	return nil, fmt.Errorf("cannot find %v provider in terraform file", provider)
+}
+
+// terraformAttribute reads the literal value of the attribute of the given
+// resource from the `main.tf` file of the node. Attributes of nested blocks
+// can be referred with dots, i.e. "root_block_device.volume_size".
+func terraformAttribute(name, resourceType, resourceName, attribute string) (cty.Value, error) {
+	path := filepath.Join(util.NodePath(name), "main.tf")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	file, diags := hclsyntax.ParseConfig(data, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return cty.NilVal, fmt.Errorf("invalid terraform file")
+	}
+
+	labels := []string{resourceType, resourceName}
+	blockType := "resource"
+	names := strings.Split(attribute, ".")
+	for _, nested := range names[:len(names)-1] {
+		body = findBlock(body, blockType, labels)
+		if body == nil {
+			return cty.NilVal, fmt.Errorf("cannot find %v of resource %v.%v in terraform file", attribute, resourceType, resourceName)
+		}
+		blockType, labels = nested, nil
+	}
+	body = findBlock(body, blockType, labels)
+	if body == nil {
+		return cty.NilVal, fmt.Errorf("cannot find %v of resource %v.%v in terraform file", attribute, resourceType, resourceName)
+	}
+	attr, ok := body.Attributes[names[len(names)-1]]
+	if !ok {
+		return cty.NilVal, fmt.Errorf("cannot find %v of resource %v.%v in terraform file", attribute, resourceType, resourceName)
+	}
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	return value, nil
+}
+
+// findBlock returns the body of the first block with given type and labels.
+func findBlock(body *hclsyntax.Body, blockType string, labels []string) *hclsyntax.Body {
+	for _, block := range body.Blocks {
+		if block.Type != blockType || len(block.Labels) != len(labels) {
+			continue
+		}
+		match := true
+		for i := range labels {
+			if block.Labels[i] != labels[i] {
+				match = false
+			}
+		}
+		if match {
+			return block.Body
+		}
+	}
+	return nil
+}
+
+// setTerraformAttribute updates the attribute of the given resource in the
+// `main.tf` file of the node. Attributes of nested blocks can be referred with
+// dots, i.e. "root_block_device.volume_size".
+func setTerraformAttribute(name, resourceType, resourceName, attribute string, value cty.Value) error {
+	path := filepath.Join(util.NodePath(name), "main.tf")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file, diags := hclwrite.ParseConfig(data, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return diags
+	}
+	block := file.Body().FirstMatchingBlock("resource", []string{resourceType, resourceName})
+	if block == nil {
+		return fmt.Errorf("cannot find resource %v.%v in terraform file", resourceType, resourceName)
+	}
+	names := strings.Split(attribute, ".")
+	for _, nested := range names[:len(names)-1] {
+		block = block.Body().FirstMatchingBlock(nested, nil)
+		if block == nil {
+			return fmt.Errorf("cannot find %v of resource %v.%v in terraform file", attribute, resourceType, resourceName)
+		}
+	}
+	block.Body().SetAttributeValue(names[len(names)-1], value)
+	return ioutil.WriteFile(path, file.Bytes(), 0600)
+}
+
+// planTerraform creates a terraform plan for the node with given name and
+// returns the addresses of the resources which would be destroyed by the plan.
+func planTerraform(name, planFile string) ([]string, error) {
+	if err := runTerraform(name, "plan", "-no-color", "-out="+planFile); err != nil {
+		return nil, err
+	}
+	show, err := terraformCommand(name, "show", "-json", planFile)
+	if err != nil {
+		return nil, err
+	}
+	output, err := show.Output()
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Change  struct {
+				Actions []string `json:"actions"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("cannot parse terraform plan, err = %v", err)
+	}
+	destroyed := make([]string, 0)
+	for _, change := range result.ResourceChanges {
+		if util.StringInSlice("delete", change.Change.Actions) {
+			destroyed = append(destroyed, change.Address)
+		}
+	}
+	return destroyed, nil
+}
+
+// terraformResources returns the attributes of the resources in the terraform
+// state of the node, indexed by the address of the resource.
+func terraformResources(name string) (map[string]map[string]interface{}, error) {
+	show, err := terraformCommand(name, "show", "-json", "-no-color")
+	if err != nil {
+		return nil, err
+	}
+	output, err := show.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read terraform state, err = %v", err)
+	}
+	return parseTerraformResources(output)
+}
+
+// parseTerraformResources parses the output of `terraform show -json` and
+// returns the attributes of the resources in the root module.
+func parseTerraformResources(data []byte) (map[string]map[string]interface{}, error) {
+	var state struct {
+		Values struct {
+			RootModule struct {
+				Resources []struct {
+					Address string                 `json:"address"`
+					Values  map[string]interface{} `json:"values"`
+				} `json:"resources"`
+			} `json:"root_module"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("cannot parse terraform state, err = %v", err)
+	}
+	resources := map[string]map[string]interface{}{}
+	for _, resource := range state.Values.RootModule.Resources {
+		resources[resource.Address] = resource.Values
+	}
+	return resources, nil
+}
+
+// resourceString returns the string attribute of the resource with given
+// address, or an empty string if it cannot be found.
+func resourceString(resources map[string]map[string]interface{}, address, attribute string) string {
+	value, _ := resources[address][attribute].(string)
+	return value
+}
+
+// updateInPlace updates the attributes of the given resource and applies the
+// change. It refuses to apply the change if it would destroy any resource of
+// the node. The darknode service is stopped while applying the change if
+// stopService is true.
+func updateInPlace(name, resourceType, resourceName string, attrs map[string]cty.Value, stopService bool) error {
+	path := filepath.Join(util.NodePath(name), "main.tf")
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	restore := func() {
+		if restoreErr := ioutil.WriteFile(path, original, 0600); restoreErr != nil {
+			color.Red("cannot restore terraform file, err = %v", restoreErr)
+		}
+	}
+	attributes := make([]string, 0, len(attrs))
+	for attribute := range attrs {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+	for _, attribute := range attributes {
+		if err := setTerraformAttribute(name, resourceType, resourceName, attribute, attrs[attribute]); err != nil {
+			restore()
+			return err
+		}
+	}
+
+	// Make sure the change can be done without replacing anything
+	planFile := "update.tfplan"
+	defer os.Remove(filepath.Join(util.NodePath(name), planFile))
+	destroyed, err := planTerraform(name, planFile)
+	if err == nil && len(destroyed) > 0 {
+		err = fmt.Errorf("%w: %v", ErrPlanDestroysResource, destroyed)
+	}
+	if err != nil {
+		restore()
+		return err
+	}
+
+	apply := []string{"apply", "-auto-approve", "-no-color", planFile}
+	if !stopService {
+		if err := runTerraform(name, apply...); err != nil {
+			restore()
+			return err
+		}
+		return nil
+	}
+
+	// Stop the darknode before the instance gets updated
+	stop := "systemctl --user stop darknode"
+	if err := util.RemoteRun(name, stop, "darknode"); err != nil {
+		restore()
+		return fmt.Errorf("cannot stop darknode service, err = %v", err)
+	}
+	applyErr := runTerraform(name, apply...)
+	if applyErr != nil {
+		restore()
+	}
+
+	// Always try restarting the darknode, the instance might take a while to
+	// be reachable after rebooting.
+	start := "systemctl --user start darknode"
+	for i := 0; i < 10; i++ {
+		if err = util.RemoteRun(name, start, "darknode"); err == nil {
+			break
+		}
+		time.Sleep(15 * time.Second)
+	}
+	if applyErr != nil {
+		return applyErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot start darknode service, err = %v", err)
+	}
+	return nil
+}
+
+// growFilesystem expands the partition and filesystem mounted at the given path
+// on the node to fill up the underlying disk.
+func growFilesystem(name, mountPoint string) error {
+	username, err := NodeSudoUsername(name)
+	if err != nil {
+		return err
+	}
+	script := fmt.Sprintf(`set -e
+dev=$(findmnt -n -o SOURCE %v)
+disk=$(lsblk -no pkname $dev)
+if [ -n "$disk" ]; then
+  # growpart exits with 1 and reports NOCHANGE when the partition already
+  # fills up the disk, which is not an error here.
+  rc=0
+  out=$(sudo growpart /dev/$disk $(cat /sys/class/block/$(basename $dev)/partition) 2>&1) || rc=$?
+  if [ $rc -ne 0 ]; then
+    if [ $rc -ne 1 ] || ! echo "$out" | grep -q NOCHANGE; then
+      echo "$out" >&2
+      exit $rc
+    fi
+  fi
+fi
+sudo resize2fs $dev`, mountPoint)
+	return util.RemoteRun(name, script, username)
+}
@@ -0,0 +1,239 @@
+package provider
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/renproject/multichain"
+	"github.com/renproject/nodectl/util"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParseTerraformResources(t *testing.T) {
+	state := []byte(`{
+  "format_version": "0.1",
+  "values": {
+    "outputs": {"ip": {"sensitive": false, "value": "1.2.3.4"}},
+    "root_module": {
+      "resources": [
+        {
+          "address": "aws_eip.darknode",
+          "type": "aws_eip",
+          "name": "darknode",
+          "values": {"allocation_id": "eipalloc-0123", "public_ip": "1.2.3.4"}
+        },
+        {
+          "address": "aws_key_pair.darknode",
+          "type": "aws_key_pair",
+          "name": "darknode",
+          "values": {"key_name": "my-node", "key_pair_id": "key-0456", "fingerprint": "aa:bb:cc"}
+        }
+      ]
+    }
+  }
+}`)
+	resources, err := parseTerraformResources(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		address, attribute, value string
+	}{
+		{"aws_eip.darknode", "allocation_id", "eipalloc-0123"},
+		{"aws_key_pair.darknode", "key_pair_id", "key-0456"},
+		{"aws_key_pair.darknode", "fingerprint", "aa:bb:cc"},
+		{"aws_key_pair.darknode", "missing", ""},
+		{"aws_instance.darknode", "id", ""},
+	}
+	for _, test := range tests {
+		if got := resourceString(resources, test.address, test.attribute); got != test.value {
+			t.Errorf("resourceString(%v, %v) = %q, want %q", test.address, test.attribute, got, test.value)
+		}
+	}
+
+	// A node without any resources in the state
+	resources, err = parseTerraformResources([]byte(`{"format_version": "0.1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resourceString(resources, "aws_eip.darknode", "allocation_id"); got != "" {
+		t.Errorf("expected no allocation id from empty state, got %q", got)
+	}
+
+	if _, err := parseTerraformResources([]byte("not json")); err == nil {
+		t.Error("expected error for invalid state")
+	}
+}
+
+func TestGenerateTerraformConfig(t *testing.T) {
+	util.Directory = t.TempDir()
+
+	tests := []struct {
+		name      string
+		provider  string
+		generator interface{ GenerateTerraformConfig() []byte }
+		attrs     map[string]cty.Value
+	}{
+		{
+			name:     "aws-node",
+			provider: "aws",
+			generator: terraformAWS{
+				Network:      multichain.NetworkMainnet,
+				Name:         "aws-node",
+				Region:       "us-east-1",
+				InstanceType: "t3.micro",
+				Version:      "0.4.10-mainnet12",
+				Source:       util.DefaultArtifactSource,
+				DiskSize:     50,
+				DiskType:     "gp3",
+			},
+			attrs: map[string]cty.Value{
+				"aws_instance.darknode.instance_type":                 cty.StringVal("t3.micro"),
+				"aws_instance.darknode.root_block_device.volume_size": cty.NumberIntVal(50),
+				"aws_instance.darknode.root_block_device.volume_type": cty.StringVal("gp3"),
+				"aws_key_pair.darknode.key_name":                      cty.StringVal("aws-node"),
+			},
+		},
+		{
+			name:     "do-node",
+			provider: "digitalocean",
+			generator: doTerraform{
+				Network:    multichain.NetworkTestnet,
+				Name:       "do-node",
+				Region:     "nyc1",
+				Size:       "s-1vcpu-2gb",
+				VolumeName: doVolumeName("do-node"),
+				VolumeSize: 100,
+				Version:    "0.4.10-testnet3",
+				Source:     util.DefaultArtifactSource,
+			},
+			attrs: map[string]cty.Value{
+				"digitalocean_droplet.darknode.size": cty.StringVal("s-1vcpu-2gb"),
+				"digitalocean_volume.darknode.size":  cty.NumberIntVal(100),
+			},
+		},
+		{
+			name:     "gcp-node",
+			provider: "google",
+			generator: terraformGCP{
+				Network:     multichain.NetworkMainnet,
+				Name:        "gcp-node",
+				Project:     "my-project",
+				Region:      "us-central1",
+				Zone:        "us-central1-a",
+				MachineType: "e2-small",
+				DiskSize:    30,
+				DiskType:    "pd-ssd",
+				Version:     "0.4.10-mainnet12",
+				Source:      util.DefaultArtifactSource,
+			},
+			attrs: map[string]cty.Value{
+				"google_compute_disk.darknode.size": cty.NumberIntVal(30),
+				"google_compute_disk.darknode.type": cty.StringVal("pd-ssd"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		data := test.generator.GenerateTerraformConfig()
+		if err := os.MkdirAll(util.NodePath(test.name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(util.NodePath(test.name), "main.tf"), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		// Credentials are passed through the environment, never written to
+		// the terraform file
+		config, err := terraformProviderConfig(test.name, test.provider)
+		if err != nil {
+			t.Fatalf("[%v] cannot read provider config: %v", test.name, err)
+		}
+		for _, attr := range terraformCredentialAttrs[test.provider] {
+			if _, ok := config[attr]; ok {
+				t.Errorf("[%v] provider block has credential attribute %v", test.name, attr)
+			}
+		}
+
+		for path, expected := range test.attrs {
+			parts := strings.SplitN(path, ".", 3)
+			value, err := terraformAttribute(test.name, parts[0], parts[1], parts[2])
+			if err != nil {
+				t.Errorf("[%v] cannot read %v: %v", test.name, path, err)
+				continue
+			}
+			if !value.RawEquals(expected) {
+				t.Errorf("[%v] %v = %#v, want %#v", test.name, path, value, expected)
+			}
+		}
+	}
+}
+
+func TestAWSDiskAttributes(t *testing.T) {
+	util.Directory = t.TempDir()
+
+	tests := []struct {
+		diskType string
+		iops     bool
+	}{
+		{"gp2", false},
+		{"gp3", false},
+		{"io1", true},
+	}
+	for _, test := range tests {
+		name := "node-" + test.diskType
+		tf := terraformAWS{
+			Network:      multichain.NetworkMainnet,
+			Name:         name,
+			Region:       "us-east-1",
+			InstanceType: "t3.micro",
+			Source:       util.DefaultArtifactSource,
+			DiskSize:     20,
+			DiskType:     test.diskType,
+		}
+		if err := os.MkdirAll(util.NodePath(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(util.NodePath(name), "main.tf"), tf.GenerateTerraformConfig(), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		attrs := awsDiskAttributes(name, 80)
+		if !attrs["root_block_device.volume_size"].RawEquals(cty.NumberIntVal(80)) {
+			t.Errorf("[%v] volume_size = %#v, want 80", test.diskType, attrs["root_block_device.volume_size"])
+		}
+		iops, ok := attrs["root_block_device.iops"]
+		if ok != test.iops {
+			t.Errorf("[%v] iops updated = %v, want %v", test.diskType, ok, test.iops)
+		}
+		if ok && !iops.RawEquals(cty.NumberIntVal(int64(awsIOPS(80)))) {
+			t.Errorf("[%v] iops = %#v, want %v", test.diskType, iops, awsIOPS(80))
+		}
+
+		// The grown config matches a fresh deployment of the same size
+		for attribute, value := range attrs {
+			if err := setTerraformAttribute(name, "aws_instance", "darknode", attribute, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tf.DiskSize = 80
+		fresh := name + "-fresh"
+		if err := os.MkdirAll(util.NodePath(fresh), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(util.NodePath(fresh), "main.tf"), tf.GenerateTerraformConfig(), 0600); err != nil {
+			t.Fatal(err)
+		}
+		for _, attribute := range []string{"root_block_device.volume_size", "root_block_device.volume_type", "root_block_device.iops"} {
+			grown, grownErr := terraformAttribute(name, "aws_instance", "darknode", attribute)
+			expected, expectedErr := terraformAttribute(fresh, "aws_instance", "darknode", attribute)
+			if (grownErr == nil) != (expectedErr == nil) || (grownErr == nil && !grown.RawEquals(expected)) {
+				t.Errorf("[%v] grown %v = %#v, fresh deployment has %#v", test.diskType, attribute, grown, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package nodectl
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+)
+
+// downgradeWarning explains the risk of running an older darknode version.
+const downgradeWarning = `Downgrading is risky. An older darknode may not understand the database or the
+chain state written by a newer version, which can stop it from starting or
+make it fall out of consensus. Binary auto-update is paused on the downgraded
+darknodes so the updater doesn't upgrade them again, it's resumed by the next
+upgrade.`
+
+// pauseUpdateScript disables the binary auto-update if it's enabled, and marks
+// it as paused so it can be resumed later.
+func pauseUpdateScript() string {
+	return fmt.Sprintf(`if [ "$(%v)" = "1" ]; then %v && %v; fi`,
+		getEnvScript(envUpdateBin), setEnvScript(envUpdateBin, util.ShellQuote("0")), setEnvScript(envUpdateBinPaused, util.ShellQuote("1")))
+}
+
+// resumeUpdateScript enables the binary auto-update again if it was paused by
+// a downgrade or rollback.
+func resumeUpdateScript() string {
+	return fmt.Sprintf(`if [ "$(%v)" = "1" ]; then %v && %v; fi`,
+		getEnvScript(envUpdateBinPaused), setEnvScript(envUpdateBin, util.ShellQuote("1")), unsetEnvScript(envUpdateBinPaused))
+}
+
+// installScript returns the script which installs the darknode binary of given
+// version from the url after verifying its checksum. The current binary is
+// kept as darknode.prev along with its version, unless it's the same version.
+func installScript(url, ver, checksum string, downgrade bool) string {
+	autoUpdate := resumeUpdateScript()
+	if downgrade {
+		autoUpdate = pauseUpdateScript()
+	}
+	return fmt.Sprintf(`set -e
+prev="$(%v)"
+curl -sL %v > ~/.darknode/bin/darknode-new
+%v
+chmod +x ~/.darknode/bin/darknode-new
+if [ "$prev" != %v ] && [ -f ~/.darknode/bin/darknode ]; then
+  cp -p ~/.darknode/bin/darknode ~/.darknode/bin/darknode.prev
+  %v
+fi
+mv ~/.darknode/bin/darknode-new ~/.darknode/bin/darknode
+%v
+%v`, getEnvScript(envInstalledVersion), util.ShellQuote(url), util.VerifyChecksumScript("$HOME/.darknode/bin/darknode-new", checksum), util.ShellQuote(ver),
+		setEnvScript(envPreviousVersion, `"$prev"`), setEnvScript(envInstalledVersion, util.ShellQuote(ver)), autoUpdate)
+}
+
+// rollbackScript swaps the darknode binary with the previous one and prints the
+// version it rolls back to. Running it again rolls forward.
+func rollbackScript() string {
+	return fmt.Sprintf(`set -e
+if [ ! -f ~/.darknode/bin/darknode.prev ]; then
+  echo "no previous binary to roll back to" >&2
+  exit 1
+fi
+cur="$(%v)"
+prev="$(%v)"
+if [ -z "$prev" ]; then
+  echo "version of the previous binary is unknown" >&2
+  exit 1
+fi
+mv ~/.darknode/bin/darknode ~/.darknode/bin/darknode.tmp
+mv ~/.darknode/bin/darknode.prev ~/.darknode/bin/darknode
+mv ~/.darknode/bin/darknode.tmp ~/.darknode/bin/darknode.prev
+%v
+%v
+%v
+systemctl --user restart darknode
+echo "$prev"`, getEnvScript(envInstalledVersion), getEnvScript(envPreviousVersion),
+		setEnvScript(envInstalledVersion, `"$prev"`), setEnvScript(envPreviousVersion, `"$cur"`), pauseUpdateScript())
+}
+
+// RollbackDarknode restores the darknode binary which was replaced by the last
+// update.
+func RollbackDarknode(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	tags := ctx.String("tags")
+	nodes, err := util.ParseNodesFromNameAndTags(name, tags)
+	if err != nil {
+		return err
+	}
+
+	color.Green("Rolling back darknodes...")
+	errs := make([]error, len(nodes))
+	wg := new(sync.WaitGroup)
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ver, err := rollback(nodes[i])
+			if err != nil {
+				errs[i] = fmt.Errorf("cannot roll back [%v], err = %v", nodes[i], err)
+				return
+			}
+			color.Green("- ✅ [%v] has been rolled back to %v.", nodes[i], ver)
+		}(i)
+	}
+	wg.Wait()
+
+	if err := util.HandleErrs(errs); err != nil {
+		return err
+	}
+	color.Yellow("Binary auto-update, if enabled, is paused on the rolled back darknodes until their next upgrade.")
+	return nil
+}
+
+// rollback restores the previous binary of the darknode and returns its
+// version.
+func rollback(name string) (string, error) {
+	result, err := util.RemoteExec(name, rollbackScript(), util.NodeInstanceUser(name), time.Minute)
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("%v", strings.TrimSpace(string(result.Stderr)))
+	}
+	ver := strings.TrimSpace(string(result.Stdout))
+	return ver, util.UpdateNodeMetadata(name, func(meta *util.NodeMetadata) {
+		meta.Version = ver
+	})
+}
+
+// downgradedNodes returns the darknodes which have a newer version installed
+// than the given version, along with their installed versions.
+func downgradedNodes(nodes []string, ver string) ([]string, []string, error) {
+	installed := make([]string, len(nodes))
+	errs := make([]error, len(nodes))
+	wg := new(sync.WaitGroup)
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			installed[i], errs[i] = installedVersion(nodes[i])
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("cannot read installed version of [%v], err = %v", nodes[i], errs[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := util.HandleErrs(errs); err != nil {
+		return nil, nil, err
+	}
+
+	downgraded, versions := make([]string, 0), make([]string, 0)
+	for i := range nodes {
+		if isDowngrade(ver, installed[i]) {
+			downgraded = append(downgraded, nodes[i])
+			versions = append(versions, installed[i])
+		}
+	}
+	return downgraded, versions, nil
+}
+
+// isDowngrade returns whether installing the version over the installed one is
+// a downgrade. It's not if any of the versions is unknown.
+func isDowngrade(ver, installed string) bool {
+	res, err := util.CompareVersions(ver, installed)
+	return err == nil && res < 0
+}
@@ -0,0 +1,184 @@
+package nodectl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsDowngrade(t *testing.T) {
+	tests := []struct {
+		ver       string
+		installed string
+		downgrade bool
+	}{
+		{"0.4.10-mainnet10", "0.4.10-mainnet9", false},
+		{"0.4.10-mainnet9", "0.4.10-mainnet10", true},
+		{"0.4.10-mainnet9", "0.4.10-mainnet9", false},
+		{"0.4.11-mainnet1", "0.4.10-mainnet12", false},
+		{"0.4.9-mainnet12", "0.4.10-mainnet1", true},
+		{"0.4-testnet3", "0.4.1-testnet1", true},
+		{"1.0.0", "0.9.0", false},
+		{"0.9.0", "1.0.0", true},
+		{"0.4.10-mainnet1", "", false},
+		{"", "0.4.10-mainnet1", false},
+		{"latest", "0.4.10-mainnet1", false},
+	}
+	for _, test := range tests {
+		if got := isDowngrade(test.ver, test.installed); got != test.downgrade {
+			t.Errorf("isDowngrade(%q, %q) = %v, want %v", test.ver, test.installed, got, test.downgrade)
+		}
+	}
+}
+
+// darknodeHome sets up the home folder of a darknode with the given binary and
+// updater store. systemctl is stubbed out.
+func darknodeHome(t *testing.T, binary, env string) (string, []string) {
+	for _, cmd := range []string{"bash", "curl", "sha256sum"} {
+		if _, err := exec.LookPath(cmd); err != nil {
+			t.Skipf("%v is not available", cmd)
+		}
+	}
+	home := t.TempDir()
+	bin := filepath.Join(home, ".darknode", "bin")
+	if err := os.MkdirAll(bin, 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(bin, "darknode"), binary)
+	writeFile(t, filepath.Join(home, ".darknode", ".env"), env)
+
+	stubs := t.TempDir()
+	writeFile(t, filepath.Join(stubs, "systemctl"), "#!/bin/sh\nexit 0\n")
+	if err := os.Chmod(filepath.Join(stubs, "systemctl"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return home, []string{"HOME=" + home, "PATH=" + stubs + ":" + os.Getenv("PATH")}
+}
+
+func runScript(t *testing.T, env []string, dir, script string) (string, error) {
+	cmd := exec.Command("bash", "-c", script)
+	cmd.Env = env
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+func writeFile(t *testing.T, path, data string) {
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func readEnv(t *testing.T, home string) map[string]string {
+	env := map[string]string{}
+	for _, line := range strings.Split(readFile(t, filepath.Join(home, ".darknode", ".env")), "\n") {
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+	return env
+}
+
+func TestInstallAndRollbackScript(t *testing.T) {
+	tests := []struct {
+		name      string
+		ver       string
+		downgrade bool
+		updateBin string
+		paused    string
+	}{
+		{"upgrade", "0.4.10-mainnet10", false, "1", ""},
+		{"downgrade", "0.4.10-mainnet8", true, "0", "1"},
+		{"special characters", `0.4.10-"$(touch pwned)"'`, false, "1", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home, env := darknodeHome(t, "old-binary", "DARKNODE_INSTALLED=0.4.10-mainnet9\nUPDATE_BIN=1\n")
+			newBinary := filepath.Join(t.TempDir(), "darknode")
+			writeFile(t, newBinary, "new-binary")
+			hash := sha256.Sum256([]byte("new-binary"))
+
+			script := installScript("file://"+newBinary, test.ver, hex.EncodeToString(hash[:]), test.downgrade)
+			if output, err := runScript(t, env, home, script); err != nil {
+				t.Fatalf("install failed, err = %v, output = %v", err, output)
+			}
+			if _, err := os.Stat(filepath.Join(home, "pwned")); err == nil {
+				t.Fatal("version is executed by the shell")
+			}
+			bin := filepath.Join(home, ".darknode", "bin")
+			if got := readFile(t, filepath.Join(bin, "darknode")); got != "new-binary" {
+				t.Errorf("installed binary = %q, want new-binary", got)
+			}
+			if got := readFile(t, filepath.Join(bin, "darknode.prev")); got != "old-binary" {
+				t.Errorf("previous binary = %q, want old-binary", got)
+			}
+			store := readEnv(t, home)
+			if store[envInstalledVersion] != test.ver {
+				t.Errorf("installed version = %q, want %q", store[envInstalledVersion], test.ver)
+			}
+			if store[envPreviousVersion] != "0.4.10-mainnet9" {
+				t.Errorf("previous version = %q, want 0.4.10-mainnet9", store[envPreviousVersion])
+			}
+			if store[envUpdateBin] != test.updateBin || store[envUpdateBinPaused] != test.paused {
+				t.Errorf("auto-update = %q, paused = %q, want %q, %q", store[envUpdateBin], store[envUpdateBinPaused], test.updateBin, test.paused)
+			}
+
+			// Roll back to the previous binary
+			output, err := runScript(t, env, home, rollbackScript())
+			if err != nil {
+				t.Fatalf("rollback failed, err = %v", err)
+			}
+			if strings.TrimSpace(output) != "0.4.10-mainnet9" {
+				t.Errorf("rolled back to %q, want 0.4.10-mainnet9", strings.TrimSpace(output))
+			}
+			if got := readFile(t, filepath.Join(bin, "darknode")); got != "old-binary" {
+				t.Errorf("binary after rollback = %q, want old-binary", got)
+			}
+			if got := readFile(t, filepath.Join(bin, "darknode.prev")); got != "new-binary" {
+				t.Errorf("previous binary after rollback = %q, want new-binary", got)
+			}
+			store = readEnv(t, home)
+			if store[envInstalledVersion] != "0.4.10-mainnet9" {
+				t.Errorf("installed version after rollback = %q, want 0.4.10-mainnet9", store[envInstalledVersion])
+			}
+			if store[envUpdateBin] != "0" || store[envUpdateBinPaused] != "1" {
+				t.Errorf("auto-update is not paused after rollback, got %q, %q", store[envUpdateBin], store[envUpdateBinPaused])
+			}
+		})
+	}
+}
+
+func TestInstallScriptChecksumMismatch(t *testing.T) {
+	home, env := darknodeHome(t, "old-binary", "DARKNODE_INSTALLED=0.4.10-mainnet9\n")
+	newBinary := filepath.Join(t.TempDir(), "darknode")
+	writeFile(t, newBinary, "tampered-binary")
+	hash := sha256.Sum256([]byte("new-binary"))
+
+	script := installScript("file://"+newBinary, "0.4.10-mainnet10", hex.EncodeToString(hash[:]), false)
+	if _, err := runScript(t, env, home, script); err == nil {
+		t.Fatal("expected install to fail")
+	}
+	bin := filepath.Join(home, ".darknode", "bin")
+	if got := readFile(t, filepath.Join(bin, "darknode")); got != "old-binary" {
+		t.Errorf("binary = %q, want old-binary", got)
+	}
+	if _, err := os.Stat(filepath.Join(bin, "darknode-new")); !os.IsNotExist(err) {
+		t.Error("unverified binary is left behind")
+	}
+	if got := readEnv(t, home)[envInstalledVersion]; got != "0.4.10-mainnet9" {
+		t.Errorf("installed version = %q, want 0.4.10-mainnet9", got)
+	}
+}
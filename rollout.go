@@ -0,0 +1,182 @@
+package nodectl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+)
+
+// Strategies of updating multiple darknodes.
+const (
+	StrategyAll     = "all"
+	StrategyRolling = "rolling"
+)
+
+// How long we wait for an updated darknode to become healthy, and how often we
+// check it.
+const (
+	rolloutHealthTimeout  = 5 * time.Minute
+	rolloutHealthInterval = 10 * time.Second
+)
+
+// rollout updates darknodes batch by batch. A batch is only started after all
+// the darknodes of the previous batch become healthy.
+type rollout struct {
+	batchSize      int
+	maxUnavailable int
+	pause          time.Duration
+}
+
+// parseRollout parses the rolling update options from input arguments.
+func parseRollout(ctx *cli.Context) (rollout, error) {
+	r := rollout{
+		batchSize:      ctx.Int("batch-size"),
+		maxUnavailable: ctx.Int("max-unavailable"),
+		pause:          ctx.Duration("pause-between"),
+	}
+	if r.batchSize <= 0 {
+		return rollout{}, fmt.Errorf("invalid batch size %v", r.batchSize)
+	}
+	if r.maxUnavailable <= 0 {
+		return rollout{}, fmt.Errorf("invalid max unavailable %v", r.maxUnavailable)
+	}
+	if r.batchSize > r.maxUnavailable {
+		return rollout{}, fmt.Errorf("batch size %v cannot be larger than max unavailable %v, as darknodes are unavailable while being updated", r.batchSize, r.maxUnavailable)
+	}
+	if r.pause < 0 {
+		return rollout{}, fmt.Errorf("invalid pause %v", r.pause)
+	}
+	return r, nil
+}
+
+// run updates the nodes with the given function batch by batch. It stops and
+// reports when any darknode of a batch fails to update or become healthy.
+func (r rollout) run(nodes []string, updateNode func(name string) error) error {
+	batches := (len(nodes) + r.batchSize - 1) / r.batchSize
+	for b := 0; b < batches; b++ {
+		start, end := b*r.batchSize, (b+1)*r.batchSize
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		batch := nodes[start:end]
+		others := make([]string, 0, len(nodes)-len(batch))
+		others = append(others, nodes[:start]...)
+		others = append(others, nodes[end:]...)
+		color.Green("Updating batch %v/%v: %v", b+1, batches, strings.Join(batch, ", "))
+
+		// Make sure we don't take down more darknodes than allowed
+		unhealthy := unhealthyNodes(others)
+		if len(unhealthy)+len(batch) > r.maxUnavailable {
+			color.Red("Rolling update stopped before batch %v/%v, these darknodes are unhealthy: %v", b+1, batches, strings.Join(unhealthy, ", "))
+			r.reportRemaining(nodes[start:])
+			return fmt.Errorf("updating batch %v would make more than %v darknodes unavailable", b+1, r.maxUnavailable)
+		}
+
+		errs := make([]error, len(batch))
+		wg := new(sync.WaitGroup)
+		for i := range batch {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				if errs[i] = updateNode(batch[i]); errs[i] != nil {
+					return
+				}
+				errs[i] = waitHealthy(batch[i], rolloutHealthTimeout)
+			}(i)
+		}
+		wg.Wait()
+
+		failed := 0
+		for i := range batch {
+			if errs[i] != nil {
+				failed++
+				color.Red("- ❌ [%v] %v", batch[i], errs[i])
+			} else {
+				color.Green("- ✅ [%v] has been updated and is healthy.", batch[i])
+			}
+		}
+		if failed > 0 {
+			color.Red("Rolling update stopped at batch %v/%v.", b+1, batches)
+			r.reportRemaining(nodes[end:])
+			return fmt.Errorf("%v of %v darknodes failed in batch %v", failed, len(batch), b+1)
+		}
+
+		if end < len(nodes) && r.pause > 0 {
+			color.Yellow("Waiting %v before the next batch...", r.pause)
+			time.Sleep(r.pause)
+		}
+	}
+	return nil
+}
+
+func (r rollout) reportRemaining(nodes []string) {
+	if len(nodes) > 0 {
+		color.Yellow("Darknodes not updated: %v", strings.Join(nodes, ", "))
+	}
+}
+
+// checkHealth checks the darknode service is active and the peer port is
+// reachable.
+func checkHealth(name string) error {
+	output, err := util.RemoteOutput(name, "systemctl --user is-active darknode")
+	state := strings.TrimSpace(string(output))
+	if state == "" && err != nil {
+		return fmt.Errorf("cannot connect to darknode, err = %v", err)
+	}
+	if state != "active" {
+		return fmt.Errorf("darknode service is %v", state)
+	}
+	ip, err := util.NodeIP(name)
+	if err != nil {
+		return err
+	}
+	if !portOpen(ip, 18514) {
+		return errors.New("peer port 18514 is not reachable")
+	}
+	return nil
+}
+
+// waitHealthy waits for the darknode to become healthy. It returns the last
+// health check error if the darknode is not healthy in time.
+func waitHealthy(name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := checkHealth(name)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(rolloutHealthInterval).After(deadline) {
+			return fmt.Errorf("not healthy after %v, %v", timeout, err)
+		}
+		time.Sleep(rolloutHealthInterval)
+	}
+}
+
+// unhealthyNodes returns the darknodes which fail the health check.
+func unhealthyNodes(nodes []string) []string {
+	healthy := make([]bool, len(nodes))
+	wg := new(sync.WaitGroup)
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			healthy[i] = checkHealth(nodes[i]) == nil
+		}(i)
+	}
+	wg.Wait()
+
+	unhealthy := make([]string, 0)
+	for i := range nodes {
+		if !healthy[i] {
+			unhealthy = append(unhealthy, nodes[i])
+		}
+	}
+	return unhealthy
+}
@@ -0,0 +1,346 @@
+package nodectl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/fatih/color"
+	"github.com/pkg/sftp"
+	"github.com/renproject/multichain"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+)
+
+// snapshotPath is where the snapshot is created on the darknode, relative to
+// the home directory.
+const snapshotPath = ".darknode/snapshot.tar.gz"
+
+// versionIDRegex matches the S3 object version IDs.
+var versionIDRegex = regexp.MustCompile("^[a-zA-Z0-9._-]+$")
+
+// createSnapshotScript archives the darknode data while the darknode is
+// stopped, and prints the checksum of the archive once the darknode is
+// running again.
+const createSnapshotScript = `set -e
+cd $HOME/.darknode
+rm -f snapshot.tar.gz snapshot.tar.gz.tmp
+if [ ! -d db ]; then
+  echo "cannot find the database" >&2
+  exit 1
+fi
+files=$(ls -d db genesis.json chain.wal 2>/dev/null || true)
+
+# The archive is smaller than the data, so it surely fits if the data does
+size=$(du -sb $files | awk '{s+=$1} END {print s+0}')
+available=$(($(df -Pk . | awk 'NR==2 {print $4}') * 1024))
+if [ "$available" -lt "$size" ]; then
+  echo "not enough disk space to create the snapshot, need $size bytes" >&2
+  exit 1
+fi
+
+systemctl --user stop darknode
+trap 'rm -f snapshot.tar.gz.tmp; systemctl --user start darknode' EXIT
+tar czf snapshot.tar.gz.tmp $files
+mv snapshot.tar.gz.tmp snapshot.tar.gz
+systemctl --user start darknode
+trap - EXIT
+sha256sum snapshot.tar.gz | awk '{print $1}'`
+
+// CreateSnapshot creates a snapshot of the darknode data and downloads it to
+// the local path. The darknode is only stopped while the data is archived. The
+// snapshot can be published right away with `--upload`.
+func CreateSnapshot(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	if err := util.NodeExistence(name); err != nil {
+		return err
+	}
+	output := ctx.Args().Get(1)
+	if output == "" {
+		output = fmt.Sprintf("%v-%v.tar.gz", name, time.Now().UTC().Format("20060102T150405Z"))
+	}
+	if !strings.HasSuffix(output, ".tar.gz") {
+		return fmt.Errorf("snapshot path should end with .tar.gz")
+	}
+	upload := ctx.Bool("upload")
+
+	// Resolve everything needed for publishing before stopping the darknode
+	var store storage
+	if upload {
+		var err error
+		if store, err = newStorage(ctx); err != nil {
+			return err
+		}
+	}
+	options, err := util.NodeOptions(name)
+	if err != nil {
+		return err
+	}
+
+	// Snapshot of a broken darknode is of no use
+	if err := checkHealth(name); err != nil {
+		return fmt.Errorf("[%v] is not healthy, err = %v", name, err)
+	}
+
+	color.Green("Creating snapshot of [%v], the darknode is stopped while archiving its data...", name)
+	defer util.RemoteOutput(name, fmt.Sprintf("rm -f ~/%v", snapshotPath))
+	result, err := util.RemoteExec(name, createSnapshotScript, "darknode", 0)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("cannot create snapshot of [%v], err = %v", name, strings.TrimSpace(string(result.Stderr)))
+	}
+	checksum := strings.TrimSpace(string(result.Stdout))
+	color.Green("- ✅ [%v] has been restarted.", name)
+
+	// Download the snapshot and make sure it's intact
+	if err := downloadSnapshot(name, output, checksum); err != nil {
+		return err
+	}
+	color.Green("- ✅ Snapshot of [%v] has been saved to %v", name, output)
+
+	if upload {
+		color.Yellow("- Uploading snapshot...")
+		manifest, err := store.publishSnapshot(output, options.Network, ctx.Uint64("height"), name)
+		if err != nil {
+			return err
+		}
+		color.Green("- Successfully published snapshot %v", manifest.Key)
+	}
+	return nil
+}
+
+// downloadSnapshot downloads the snapshot from the darknode and verifies its
+// checksum. The local file is only created if the snapshot is intact.
+func downloadSnapshot(name, output, checksum string) error {
+	tmp := output + ".part"
+	defer os.Remove(tmp)
+
+	c := copier{
+		node:     name,
+		progress: true,
+		mu:       new(sync.Mutex),
+	}
+	err := c.run("darknode", func(client *sftp.Client) error {
+		return c.download(client, snapshotPath, tmp)
+	})
+	if err != nil {
+		return err
+	}
+
+	actual, err := util.FileChecksum(tmp)
+	if err != nil {
+		return err
+	}
+	if actual != checksum {
+		return fmt.Errorf("checksum of the downloaded snapshot doesn't match, expected = %v, got = %v", checksum, actual)
+	}
+	return os.Rename(tmp, output)
+}
+
+// SnapshotObject is a version of a snapshot file in the bucket.
+type SnapshotObject struct {
+	Name      string    `json:"name"`
+	VersionID string    `json:"versionId"`
+	Size      int64     `json:"size"`
+	Date      time.Time `json:"date"`
+	Latest    bool      `json:"latest"`
+}
+
+// SnapshotObjects is a list of snapshot files which implements the `Tabular`
+// interface.
+type SnapshotObjects []SnapshotObject
+
+// Header implements the `Tabular` interface
+func (objects SnapshotObjects) Header() []string {
+	return []string{"name", "version", "size", "date", "latest"}
+}
+
+// Rows implements the `Tabular` interface
+func (objects SnapshotObjects) Rows() [][]string {
+	rows := make([][]string, len(objects))
+	for i, object := range objects {
+		latest := ""
+		if object.Latest {
+			latest = "yes"
+		}
+		rows[i] = []string{object.Name, object.VersionID, formatBytes(object.Size), object.Date.Format(time.RFC3339), latest}
+	}
+	return rows
+}
+
+// ListSnapshots lists all versions of the snapshot files of the network, the
+// newest first. The name and version can be used for recovering a darknode.
+// Listing the versions needs the `s3:ListBucketVersions` permission, without
+// it only the current snapshot files are listed, which still include every
+// snapshot published by `nodectl upload`.
+func ListSnapshots(ctx *cli.Context) error {
+	format, err := parseOutputFormat(ctx.String("output"))
+	if err != nil {
+		return err
+	}
+	network := multichain.Network(ctx.String("network"))
+	store, err := newPublicStorage(ctx)
+	if err != nil {
+		return err
+	}
+
+	objects, err := store.listSnapshotVersions(network)
+	if isAccessDenied(err) {
+		color.New(color.FgYellow).Fprintf(os.Stderr, "Not allowed to list the snapshot versions, listing the current snapshots only.\n")
+		objects, err = store.listSnapshots(network)
+		if isAccessDenied(err) {
+			return fmt.Errorf("cannot list snapshots, listing the bucket [%v] is not allowed, err = %v", store.bucket, err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot list snapshots, err = %v", err)
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return objects[i].Date.After(objects[j].Date)
+	})
+	return printOutput(format, objects)
+}
+
+// listSnapshotVersions lists all versions of the snapshot files of the network.
+func (store storage) listSnapshotVersions(network multichain.Network) (SnapshotObjects, error) {
+	prefix := fmt.Sprintf("%v/", network)
+	objects := SnapshotObjects{}
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(store.bucket),
+		Prefix: aws.String(prefix),
+	}
+	err := store.client.ListObjectVersionsPages(input, func(page *s3.ListObjectVersionsOutput, last bool) bool {
+		for _, version := range page.Versions {
+			key := aws.StringValue(version.Key)
+			if !strings.HasSuffix(key, ".tar.gz") {
+				continue
+			}
+			objects = append(objects, SnapshotObject{
+				Name:      strings.TrimPrefix(key, prefix),
+				VersionID: aws.StringValue(version.VersionId),
+				Size:      aws.Int64Value(version.Size),
+				Date:      aws.TimeValue(version.LastModified),
+				Latest:    aws.BoolValue(version.IsLatest),
+			})
+		}
+		return true
+	})
+	return objects, err
+}
+
+// listSnapshots lists the current version of the snapshot files of the
+// network. The snapshots published by `nodectl upload` are never overwritten,
+// so they're all listed.
+func (store storage) listSnapshots(network multichain.Network) (SnapshotObjects, error) {
+	prefix := fmt.Sprintf("%v/", network)
+	objects := SnapshotObjects{}
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(store.bucket),
+		Prefix: aws.String(prefix),
+	}
+	err := store.client.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, object := range page.Contents {
+			key := aws.StringValue(object.Key)
+			if !strings.HasSuffix(key, ".tar.gz") {
+				continue
+			}
+			objects = append(objects, SnapshotObject{
+				Name:   strings.TrimPrefix(key, prefix),
+				Size:   aws.Int64Value(object.Size),
+				Date:   aws.TimeValue(object.LastModified),
+				Latest: true,
+			})
+		}
+		return true
+	})
+	return objects, err
+}
+
+// isAccessDenied returns whether the error is a S3 request which is not
+// allowed.
+func isAccessDenied(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == "AccessDenied"
+}
+
+// PinSnapshot pins the updater of the darknodes to the given version of
+// latest.tar.gz. The darknodes are recovered from that version instead of
+// every new snapshot.
+func PinSnapshot(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	tags := ctx.String("tags")
+	versionID := strings.TrimSpace(ctx.String("snapshot-version"))
+	if !versionIDRegex.MatchString(versionID) {
+		return fmt.Errorf("invalid snapshot version [%v]", versionID)
+	}
+	nodes, err := util.ParseNodesFromNameAndTags(name, tags)
+	if err != nil {
+		return err
+	}
+
+	return updateSnapshotPin(nodes, func(node string) (string, error) {
+		options, err := util.NodeOptions(node)
+		if err != nil {
+			return "", err
+		}
+		source, err := util.NodeArtifactSource(node)
+		if err != nil {
+			return "", err
+		}
+		// Make sure the version exists and can be verified
+		if _, err := util.SnapshotChecksum(source, options.Network, "", versionID); err != nil {
+			return "", fmt.Errorf("cannot use snapshot version %v, err = %v", versionID, err)
+		}
+		return setEnvScript(envSnapshotPinned, util.ShellQuote(versionID)), nil
+	}, fmt.Sprintf("has been pinned to snapshot version %v", versionID))
+}
+
+// UnpinSnapshot removes the snapshot pin of the darknodes, so they're
+// recovered from the latest snapshot again.
+func UnpinSnapshot(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	tags := ctx.String("tags")
+	nodes, err := util.ParseNodesFromNameAndTags(name, tags)
+	if err != nil {
+		return err
+	}
+
+	return updateSnapshotPin(nodes, func(string) (string, error) {
+		return unsetEnvScript(envSnapshotPinned), nil
+	}, "follows the latest snapshot again")
+}
+
+// updateSnapshotPin runs the script returned by the given function on all the
+// darknodes.
+func updateSnapshotPin(nodes []string, script func(node string) (string, error), message string) error {
+	errs := make([]error, len(nodes))
+	wg := new(sync.WaitGroup)
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			s, err := script(nodes[i])
+			if err == nil {
+				_, err = util.RemoteOutput(nodes[i], s)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("cannot update [%v], err = %v", nodes[i], err)
+				return
+			}
+			color.Green("- ✅ [%v] %v.", nodes[i], message)
+		}(i)
+	}
+	wg.Wait()
+	return util.HandleErrs(errs)
+}
@@ -0,0 +1,88 @@
+package nodectl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+)
+
+// SetArtifactSource changes where the darknodes get their config, snapshots
+// and binaries from, for both nodectl and the updater on the darknodes.
+func SetArtifactSource(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	tags := ctx.String("tags")
+	if !ctx.IsSet("artifact-source") {
+		return errors.New("please specify the artifact source with --artifact-source")
+	}
+	source, err := util.ParseArtifactSource(ctx.String("artifact-source"))
+	if err != nil {
+		return err
+	}
+	nodes, err := util.ParseNodesFromNameAndTags(name, tags)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(nodes))
+	wg := new(sync.WaitGroup)
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			if err := setArtifactSource(nodes[i], source); err != nil {
+				errs[i] = fmt.Errorf("cannot update [%v], err = %v", nodes[i], err)
+				return
+			}
+			color.Green("- ✅ [%v] gets its artifacts from %v.", nodes[i], source)
+		}(i)
+	}
+	wg.Wait()
+	return util.HandleErrs(errs)
+}
+
+// setArtifactSource switches the darknode to the source. The installed
+// versions of the config and snapshot are recorded as the current ones of the
+// new source, as the version IDs of different sources don't match and the
+// updater would take the switch as an update. The snapshot pin is removed for
+// the same reason.
+func setArtifactSource(name string, source util.ArtifactSource) error {
+	// The source is recorded in the metadata, which older darknodes don't have
+	if _, err := util.ReadNodeMetadata(name); err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("metadata not found, please run `nodectl migrate` first")
+		}
+		return err
+	}
+	options, err := util.NodeOptions(name)
+	if err != nil {
+		return err
+	}
+	configVersionID, err := source.VersionID(options.Network, "config.json")
+	if err != nil {
+		return err
+	}
+	snapshotVersionID, err := source.VersionID(options.Network, util.LatestSnapshot)
+	if err != nil {
+		return err
+	}
+
+	script := strings.Join([]string{
+		setEnvScript(envArtifactSource, util.ShellQuote(source.String())),
+		setEnvScript(envConfigVersion, util.ShellQuote(configVersionID)),
+		setEnvScript(envSnapshotVersion, util.ShellQuote(snapshotVersionID)),
+		unsetEnvScript(envSnapshotPinned),
+	}, " && ")
+	if _, err := util.RemoteOutput(name, script); err != nil {
+		return err
+	}
+	return util.UpdateNodeMetadata(name, func(meta *util.NodeMetadata) {
+		meta.ArtifactSource = source.String()
+	})
+}
@@ -0,0 +1,200 @@
+package nodectl
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/renproject/nodectl/provider"
+	"github.com/renproject/nodectl/util"
+	"github.com/urfave/cli/v2"
+)
+
+// statusScript prints the health details of the darknode as key=value pairs.
+const statusScript = `echo "darknode=$(systemctl --user is-active darknode)"
+echo "updater=$(systemctl --user is-active darknode-updater)"
+echo "uptime=$(uptime -p)"
+grep -E '^(DARKNODE_INSTALLED|DARKNODE_CONFIG_VERSIONID|DARKNODE_SNAPSHOT_VERSIONID)=' $HOME/.darknode/.env
+echo "disk=$(df -h $HOME/.darknode | awk 'NR==2 {print $3"/"$2" ("$5")"}')"
+echo "memory=$(free -h | awk '/^Mem:/ {print $3"/"$2}')"`
+
+// NodeStatus is the live health of a node.
+type NodeStatus struct {
+	Name              string `json:"name"`
+	Instance          string `json:"instance"`
+	Darknode          string `json:"darknode"`
+	Updater           string `json:"updater"`
+	Uptime            string `json:"uptime"`
+	Version           string `json:"version"`
+	ConfigVersionID   string `json:"configVersionId"`
+	SnapshotVersionID string `json:"snapshotVersionId"`
+	Disk              string `json:"disk"`
+	Memory            string `json:"memory"`
+	Port18514         bool   `json:"port18514"`
+	Port18515         bool   `json:"port18515"`
+	Error             string `json:"error,omitempty"`
+}
+
+// NodeStatuses is a list of NodeStatus which implements the `Tabular` interface.
+type NodeStatuses []NodeStatus
+
+// Header implements the `Tabular` interface
+func (statuses NodeStatuses) Header() []string {
+	return []string{"name", "instance", "darknode", "updater", "version", "uptime", "disk", "memory", "18514", "18515", "error"}
+}
+
+// Rows implements the `Tabular` interface
+func (statuses NodeStatuses) Rows() [][]string {
+	rows := make([][]string, len(statuses))
+	for i, status := range statuses {
+		rows[i] = []string{
+			status.Name,
+			status.Instance,
+			status.Darknode,
+			status.Updater,
+			status.Version,
+			status.Uptime,
+			status.Disk,
+			status.Memory,
+			portState(status.Port18514),
+			portState(status.Port18515),
+			status.Error,
+		}
+	}
+	return rows
+}
+
+func portState(open bool) string {
+	if open {
+		return "open"
+	}
+	return "closed"
+}
+
+// ShowStatus displays the live health of the darknodes. All darknodes are
+// checked if neither name nor tags is given.
+func ShowStatus(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	tags := ctx.String("tags")
+	watch := ctx.Bool("watch")
+	interval := ctx.Duration("interval")
+	format, err := parseOutputFormat(ctx.String("output"))
+	if err != nil {
+		return err
+	}
+	if watch && interval <= 0 {
+		return fmt.Errorf("invalid refresh interval %v", interval)
+	}
+	nodes, err := parseNodesOrAll(name, tags)
+	if err != nil {
+		return err
+	}
+
+	for {
+		statuses := nodeStatuses(nodes)
+		if watch && format == OutputTable {
+			// Clear the terminal before redrawing the table
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("Every %v: nodectl status  %v\n\n", interval, time.Now().Format(time.RFC1123))
+		}
+		if err := printOutput(format, statuses); err != nil {
+			return err
+		}
+		if !watch {
+			return nil
+		}
+		time.Sleep(interval)
+	}
+}
+
+// nodeStatuses fetches the status of the nodes in parallel.
+func nodeStatuses(nodes []string) NodeStatuses {
+	statuses := make(NodeStatuses, len(nodes))
+	wg := new(sync.WaitGroup)
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i] = GetNodeStatus(nodes[i])
+		}(i)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// GetNodeStatus returns the live health of the node with given name. Errors are
+// recorded in the returned status, so the details which can be fetched are
+// still available.
+func GetNodeStatus(name string) NodeStatus {
+	status := NodeStatus{
+		Name:     name,
+		Instance: "unknown",
+	}
+	errs := make([]string, 0)
+
+	// Status of the instance from the cloud provider
+	p, err := provider.ParseNodeProvider(name)
+	if err == nil {
+		status.Instance, err = p.Status(name)
+	}
+	if err != nil {
+		status.Instance = "unknown"
+		errs = append(errs, fmt.Sprintf("cannot get instance status, err = %v", err))
+	}
+
+	// Check whether the ports are reachable from here
+	ip, err := util.NodeIP(name)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Port18514 = portOpen(ip, 18514)
+	status.Port18515 = portOpen(ip, 18515)
+
+	// Details which can only be found on the instance
+	output, err := util.RemoteOutput(name, statusScript)
+	if err != nil && len(output) == 0 {
+		errs = append(errs, fmt.Sprintf("cannot connect to darknode, err = %v", err))
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.Trim(strings.TrimSpace(parts[1]), "\"'")
+		switch parts[0] {
+		case "darknode":
+			status.Darknode = value
+		case "updater":
+			status.Updater = value
+		case "uptime":
+			status.Uptime = strings.TrimPrefix(value, "up ")
+		case "DARKNODE_INSTALLED":
+			status.Version = value
+		case "DARKNODE_CONFIG_VERSIONID":
+			status.ConfigVersionID = value
+		case "DARKNODE_SNAPSHOT_VERSIONID":
+			status.SnapshotVersionID = value
+		case "disk":
+			status.Disk = value
+		case "memory":
+			status.Memory = value
+		}
+	}
+	status.Error = strings.Join(errs, "; ")
+	return status
+}
+
+// portOpen checks if the port of the given ip address accepts tcp connections.
+func portOpen(ip string, port int) bool {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%v:%v", ip, port), 5*time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
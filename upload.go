@@ -1,18 +1,29 @@
 package nodectl
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/fatih/color"
+	"github.com/renproject/multichain"
+	"github.com/renproject/nodectl/provider"
 	"github.com/renproject/nodectl/renvm"
+	"github.com/renproject/nodectl/util"
 	"github.com/urfave/cli/v2"
 )
 
@@ -22,12 +33,17 @@ var (
 	BucketName = "darknode.renproject.io"
 )
 
+// S3 can only copy objects up to 5GB in a single request, larger objects are
+// copied in parts.
+const (
+	maxCopySize  = 5 << 30
+	copyPartSize = 512 << 20
+)
+
 func Upload(ctx *cli.Context) error {
 	config := ctx.String("config")
 	snapshot := ctx.String("snapshot")
-	network := ctx.String("network")
-	accessKey := ctx.String("aws-access-key")
-	secretKey := ctx.String("aws-secret-key")
+	network := multichain.Network(ctx.String("network"))
 
 	// Some validation for input arguments
 	if snapshot == "" && config == "" {
@@ -47,33 +63,14 @@ func Upload(ctx *cli.Context) error {
 		}
 	}
 
-	// Try reading the default credential file if user does not provide credentials directly
-	if accessKey == "" || secretKey == "" {
-		cred := credentials.NewSharedCredentials("", ctx.String("aws-profile"))
-		credValue, err := cred.Get()
-		if err != nil {
-			return errors.New("invalid credentials")
-		}
-		accessKey, secretKey = credValue.AccessKeyID, credValue.SecretAccessKey
-		if accessKey == "" || secretKey == "" {
-			return errors.New("invalid credentials")
-		}
-	}
-
-	// initialise AWS uploader
-	cred := credentials.NewStaticCredentials(accessKey, secretKey, "")
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String(BucketRegion),
-		Credentials: cred,
-	})
+	store, err := newStorage(ctx)
 	if err != nil {
 		return err
 	}
-	uploader := s3manager.NewUploader(sess)
 
 	if config != "" {
 		color.Yellow("- Uploading config file...")
-		if err := uploadConfig(config, network, uploader); err != nil {
+		if err := store.uploadConfig(config, network); err != nil {
 			return err
 		}
 		color.Green("- Successfully uploaded config file")
@@ -81,16 +78,70 @@ func Upload(ctx *cli.Context) error {
 
 	if snapshot != "" {
 		color.Yellow("- Uploading snapshot...")
-		if err := uploadSnapshot(config, network, uploader); err != nil {
+		manifest, err := store.publishSnapshot(snapshot, network, ctx.Uint64("height"), ctx.String("source"))
+		if err != nil {
 			return err
 		}
-		color.Green("- Successfully uploaded snapshot")
+		color.Green("- Successfully published snapshot %v", manifest.Key)
 	}
 
 	return nil
 }
 
-func uploadConfig(filePath, network string, uploader *s3manager.Uploader) error {
+// storage is the S3 bucket where the config and snapshots are published.
+type storage struct {
+	bucket   string
+	client   *s3.S3
+	uploader *s3manager.Uploader
+}
+
+// newStorage connects to the bucket given by the input arguments. Any
+// S3-compatible storage can be used by giving its endpoint.
+func newStorage(ctx *cli.Context) (storage, error) {
+	creds, err := provider.ResolveCredentials(ctx, provider.NameAws)
+	if err != nil {
+		return storage{}, err
+	}
+	cred, err := provider.AWSCredentials(creds)
+	if err != nil {
+		return storage{}, err
+	}
+	return connectStorage(ctx, cred)
+}
+
+// newPublicStorage connects to the bucket for reading. The bucket is read
+// anonymously if there are no AWS credentials, which works for public buckets.
+func newPublicStorage(ctx *cli.Context) (storage, error) {
+	store, err := newStorage(ctx)
+	if err == nil {
+		return store, nil
+	}
+	// Keep stdout clean for the command output
+	color.New(color.FgYellow).Fprintf(os.Stderr, "No valid AWS credentials (%v), reading the bucket anonymously.\n", err)
+	return connectStorage(ctx, credentials.AnonymousCredentials)
+}
+
+func connectStorage(ctx *cli.Context, cred *credentials.Credentials) (storage, error) {
+	config := &aws.Config{
+		Region:      aws.String(ctx.String("region")),
+		Credentials: cred,
+	}
+	if endpoint := ctx.String("endpoint"); endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return storage{}, err
+	}
+	return storage{
+		bucket:   ctx.String("bucket"),
+		client:   s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+	}, nil
+}
+
+func (store storage) uploadConfig(filePath string, network multichain.Network) error {
 	// Validate the file is a valid config file
 	_, err := renvm.NewOptionsFromFile(filePath)
 	if err != nil {
@@ -104,37 +155,176 @@ func uploadConfig(filePath, network string, uploader *s3manager.Uploader) error
 	}
 	defer file.Close()
 
-	// Upload the file
-	acl := "public-read"
-	_, err = uploader.Upload(&s3manager.UploadInput{
-		ACL:    &acl,
-		Bucket: aws.String(BucketName),
-		Key:    aws.String(fmt.Sprintf("/%v/config.json", network)),
-		Body:   file,
-	})
-	return err
+	return store.put(fmt.Sprintf("%v/config.json", network), file, nil)
 }
 
-func uploadSnapshot(snapshotPath, network string, uploader *s3manager.Uploader) error {
+// publishSnapshot uploads the snapshot under its content-addressed key along
+// with its checksum and manifest. latest.tar.gz is only pointed to the new
+// snapshot after the upload is verified.
+func (store storage) publishSnapshot(snapshotPath string, network multichain.Network, height uint64, source string) (util.SnapshotManifest, error) {
 	// Make sure the format is '.tar.gz'
 	if !strings.HasSuffix(snapshotPath, ".tar.gz") {
-		return fmt.Errorf("invalid snapshot format")
+		return util.SnapshotManifest{}, fmt.Errorf("invalid snapshot format")
 	}
 
-	// Open the file
+	info, err := os.Stat(snapshotPath)
+	if err != nil {
+		return util.SnapshotManifest{}, err
+	}
+	checksum, err := util.FileChecksum(snapshotPath)
+	if err != nil {
+		return util.SnapshotManifest{}, err
+	}
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	manifest := util.SnapshotManifest{
+		Key:       util.SnapshotKey(network, createdAt, checksum),
+		Sha256:    checksum,
+		Size:      info.Size(),
+		Height:    height,
+		CreatedAt: createdAt,
+		Source:    source,
+	}
+
+	// Upload the snapshot and make sure it's intact
 	file, err := os.Open(snapshotPath)
 	if err != nil {
-		return err
+		return util.SnapshotManifest{}, err
 	}
 	defer file.Close()
+	// The checksum is recorded in the metadata, so every version of
+	// latest.tar.gz can be verified
+	metadata := map[string]*string{"sha256": aws.String(checksum)}
+	if err := store.put(manifest.Key, file, metadata); err != nil {
+		return util.SnapshotManifest{}, fmt.Errorf("cannot upload snapshot, err = %v", err)
+	}
+	if err := store.verify(manifest.Key, manifest.Size, manifest.Sha256); err != nil {
+		return util.SnapshotManifest{}, fmt.Errorf("cannot verify uploaded snapshot, err = %v", err)
+	}
+	checksumData := fmt.Sprintf("%v  %v\n", checksum, filepath.Base(manifest.Key))
+	if err := store.put(util.ChecksumName(manifest.Key), strings.NewReader(checksumData), nil); err != nil {
+		return util.SnapshotManifest{}, err
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return util.SnapshotManifest{}, err
+	}
+	if err := store.put(util.ManifestName(manifest.Key), bytes.NewReader(manifestData), nil); err != nil {
+		return util.SnapshotManifest{}, err
+	}
+
+	// Point latest.tar.gz to the new snapshot. The checksum and manifest go
+	// first, so anyone who sees the new snapshot also sees its checksum.
+	// Readers who get the old snapshot with the new checksum can tell from
+	// the size recorded in the manifest.
+	latest := fmt.Sprintf("%v/%v", network, util.LatestSnapshot)
+	checksumData = fmt.Sprintf("%v  %v\n", checksum, util.LatestSnapshot)
+	if err := store.put(util.ChecksumName(latest), strings.NewReader(checksumData), nil); err != nil {
+		return util.SnapshotManifest{}, err
+	}
+	if err := store.put(util.ManifestName(latest), bytes.NewReader(manifestData), nil); err != nil {
+		return util.SnapshotManifest{}, err
+	}
+	if err := store.copy(manifest.Key, latest, manifest.Size, metadata); err != nil {
+		return util.SnapshotManifest{}, fmt.Errorf("cannot update %v, err = %v", latest, err)
+	}
+	return manifest, nil
+}
 
-	// Upload the file
-	acl := "public-read"
-	_, err = uploader.Upload(&s3manager.UploadInput{
-		ACL:    &acl,
-		Bucket: aws.String(BucketName),
-		Key:    aws.String(fmt.Sprintf("/%v/latest.tar.gz", network)),
-		Body:   file,
+// put uploads the object with public read access.
+func (store storage) put(key string, body io.Reader, metadata map[string]*string) error {
+	_, err := store.uploader.Upload(&s3manager.UploadInput{
+		ACL:      aws.String(s3.ObjectCannedACLPublicRead),
+		Bucket:   aws.String(store.bucket),
+		Key:      aws.String(key),
+		Body:     body,
+		Metadata: metadata,
+	})
+	return err
+}
+
+// verify downloads the object and checks its size and checksum.
+func (store storage) verify(key string, size int64, checksum string) error {
+	output, err := store.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer output.Body.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, output.Body)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("size mismatch, expected = %v, got = %v", size, n)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != checksum {
+		return fmt.Errorf("checksum mismatch")
+	}
+	return nil
+}
+
+// copy copies the object within the bucket with the given metadata, in parts
+// if it's too large for a single request.
+func (store storage) copy(src, dst string, size int64, metadata map[string]*string) error {
+	source := url.PathEscape(store.bucket) + "/" + (&url.URL{Path: src}).EscapedPath()
+	if size <= maxCopySize {
+		_, err := store.client.CopyObject(&s3.CopyObjectInput{
+			ACL:               aws.String(s3.ObjectCannedACLPublicRead),
+			Bucket:            aws.String(store.bucket),
+			CopySource:        aws.String(source),
+			Key:               aws.String(dst),
+			Metadata:          metadata,
+			MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+		})
+		return err
+	}
+
+	upload, err := store.client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		ACL:      aws.String(s3.ObjectCannedACLPublicRead),
+		Bucket:   aws.String(store.bucket),
+		Key:      aws.String(dst),
+		Metadata: metadata,
+	})
+	if err != nil {
+		return err
+	}
+	parts := make([]*s3.CompletedPart, 0, size/copyPartSize+1)
+	for start := int64(0); start < size; start += copyPartSize {
+		end := start + copyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		partNumber := int64(len(parts) + 1)
+		output, err := store.client.UploadPartCopy(&s3.UploadPartCopyInput{
+			Bucket:          aws.String(store.bucket),
+			CopySource:      aws.String(source),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%v-%v", start, end)),
+			Key:             aws.String(dst),
+			PartNumber:      aws.Int64(partNumber),
+			UploadId:        upload.UploadId,
+		})
+		if err != nil {
+			store.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(store.bucket),
+				Key:      aws.String(dst),
+				UploadId: upload.UploadId,
+			})
+			return err
+		}
+		parts = append(parts, &s3.CompletedPart{
+			ETag:       output.CopyPartResult.ETag,
+			PartNumber: aws.Int64(partNumber),
+		})
+	}
+	_, err = store.client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(store.bucket),
+		Key:             aws.String(dst),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		UploadId:        upload.UploadId,
 	})
 	return err
 }
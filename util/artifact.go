@@ -0,0 +1,349 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/renproject/multichain"
+	"github.com/renproject/nodectl/renvm"
+)
+
+// DefaultArtifactSource is the public bucket maintained by Ren, with the
+// darknode binaries released on Github.
+var DefaultArtifactSource ArtifactSource = publicSource{}
+
+// fileClient reads the files of local directory sources. It's kept apart from
+// the default client, so remote sources cannot redirect to local files.
+var fileClient = &http.Client{Transport: http.NewFileTransport(http.Dir("/"))}
+
+// httpClient returns the client which fetches the url.
+func httpClient(url string) *http.Client {
+	if strings.HasPrefix(url, "file://") {
+		return fileClient
+	}
+	return http.DefaultClient
+}
+
+// ArtifactSource is where a darknode gets its config template, snapshots and
+// binaries from. Files of a network are kept under the folder named after the
+// network, i.e. `mainnet/config.json` and `mainnet/latest.tar.gz`.
+type ArtifactSource interface {
+	// FileURL returns the url of the file of the network.
+	FileURL(network multichain.Network, name string) string
+
+	// VersionURL returns the url of the given version of the file. The
+	// current version is used if the version ID is empty.
+	VersionURL(network multichain.Network, name, versionID string) (string, error)
+
+	// VersionID returns the ID of the current version of the file, which
+	// changes whenever the file is replaced.
+	VersionID(network multichain.Network, name string) (string, error)
+
+	// LatestRelease returns the tag of the latest darknode release of the
+	// network.
+	LatestRelease(network multichain.Network) (string, error)
+
+	// BinaryURL returns the url of the darknode binary of the release.
+	BinaryURL(tag string) string
+
+	// BinaryChecksum returns the sha256 checksum of the darknode binary of the
+	// release.
+	BinaryChecksum(tag string) (string, error)
+
+	// UpdaterURL returns the url of the latest darknode-updater binary.
+	UpdaterURL() string
+
+	// String returns the spec of the source, which can be parsed by
+	// `ParseArtifactSource`.
+	String() string
+}
+
+// ParseArtifactSource parses the spec of an artifact source, which is one of
+//   - `public` or empty for the default source
+//   - `s3+https://endpoint/bucket` for any S3-compatible bucket
+//   - `https://host/path` for a plain HTTPS mirror
+//   - `file:///path` or an absolute path for a local directory
+func ParseArtifactSource(spec string) (ArtifactSource, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "public" {
+		return DefaultArtifactSource, nil
+	}
+	if filepath.IsAbs(spec) {
+		return localSource{mirror{base: "file://" + filepath.Clean(spec)}}, nil
+	}
+
+	url, err := neturl.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid artifact source [%v], err = %v", spec, err)
+	}
+	switch url.Scheme {
+	case "s3+https", "s3+http":
+		if url.Host == "" || strings.Trim(url.Path, "/") == "" {
+			return nil, fmt.Errorf("invalid artifact source [%v], expect s3+https://endpoint/bucket", spec)
+		}
+		url.Scheme = strings.TrimPrefix(url.Scheme, "s3+")
+		return s3Source{mirror{base: strings.TrimSuffix(url.String(), "/")}}, nil
+	case "https", "http":
+		if url.Host == "" {
+			return nil, fmt.Errorf("invalid artifact source [%v], missing host", spec)
+		}
+		return httpSource{mirror{base: strings.TrimSuffix(url.String(), "/")}}, nil
+	case "file":
+		if url.Host != "" || !path.IsAbs(url.Path) {
+			return nil, fmt.Errorf("invalid artifact source [%v], expect file:///path", spec)
+		}
+		return localSource{mirror{base: "file://" + path.Clean(url.Path)}}, nil
+	case "":
+		return nil, fmt.Errorf("invalid artifact source [%v], expect a url or an absolute path", spec)
+	default:
+		return nil, fmt.Errorf("invalid artifact source [%v], unsupported scheme [%v]", spec, url.Scheme)
+	}
+}
+
+// OptionTemplate fetches the config template of the network from the source.
+func OptionTemplate(source ArtifactSource, network multichain.Network) (renvm.Options, error) {
+	body, err := fetch(source.FileURL(network, "config.json"))
+	if err != nil {
+		return renvm.Options{}, err
+	}
+	defer body.Close()
+
+	var opts renvm.Options
+	if err := json.NewDecoder(body).Decode(&opts); err != nil {
+		return renvm.Options{}, err
+	}
+	return opts, nil
+}
+
+// NodeArtifactSource returns the artifact source of the node with given name.
+// Nodes which haven't selected one use the default source.
+func NodeArtifactSource(name string) (ArtifactSource, error) {
+	meta, err := ReadNodeMetadata(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DefaultArtifactSource, nil
+		}
+		return nil, err
+	}
+	return ParseArtifactSource(meta.ArtifactSource)
+}
+
+// publicSource is the public S3 bucket maintained by Ren. The binaries are
+// released on Github.
+type publicSource struct{}
+
+// FileURL implements the `ArtifactSource` interface. The network must be a
+// valid network, otherwise the function will panic.
+func (publicSource) FileURL(network multichain.Network, name string) string {
+	switch network {
+	case multichain.NetworkMainnet, multichain.NetworkTestnet, multichain.NetworkDevnet:
+		return fmt.Sprintf("https://s3.ap-southeast-1.amazonaws.com/darknode.renproject.io/%v/%v", network, name)
+	default:
+		panic("invalid network")
+	}
+}
+
+// VersionURL implements the `ArtifactSource` interface
+func (source publicSource) VersionURL(network multichain.Network, name, versionID string) (string, error) {
+	return s3VersionURL(source.FileURL(network, name), versionID), nil
+}
+
+// VersionID implements the `ArtifactSource` interface
+func (source publicSource) VersionID(network multichain.Network, name string) (string, error) {
+	return fileVersionID(source.FileURL(network, name))
+}
+
+// LatestRelease implements the `ArtifactSource` interface
+func (publicSource) LatestRelease(network multichain.Network) (string, error) {
+	return LatestRelease(network)
+}
+
+// BinaryURL implements the `ArtifactSource` interface
+func (publicSource) BinaryURL(tag string) string {
+	return fmt.Sprintf("https://github.com/renproject/darknode-release/releases/download/%v/darknode", tag)
+}
+
+// BinaryChecksum implements the `ArtifactSource` interface
+func (publicSource) BinaryChecksum(tag string) (string, error) {
+	return DarknodeChecksum(tag)
+}
+
+// UpdaterURL implements the `ArtifactSource` interface
+func (publicSource) UpdaterURL() string {
+	return "https://github.com/renproject/nodectl/releases/latest/download/darknode-updater"
+}
+
+// String implements the `ArtifactSource` interface
+func (publicSource) String() string {
+	return "public"
+}
+
+// mirror serves the artifacts from a base url with the same layout as the
+// public bucket. The releases are mirrored under `releases/`:
+//   - `releases/latest-<network>` contains the tag of the latest release
+//   - `releases/<tag>/darknode` is the binary, with its checksum in
+//     `releases/<tag>/darknode.sha256`
+//   - `releases/darknode-updater` is the updater binary
+//
+// Only the current version of the files is available from a mirror.
+type mirror struct {
+	base string
+}
+
+// FileURL implements the `ArtifactSource` interface
+func (m mirror) FileURL(network multichain.Network, name string) string {
+	return fmt.Sprintf("%v/%v/%v", m.base, network, name)
+}
+
+// VersionURL implements the `ArtifactSource` interface
+func (m mirror) VersionURL(network multichain.Network, name, versionID string) (string, error) {
+	if versionID != "" {
+		current, err := m.VersionID(network, name)
+		if err != nil {
+			return "", err
+		}
+		if current != versionID {
+			return "", fmt.Errorf("%v only serves the current version of %v", m.base, name)
+		}
+	}
+	return m.FileURL(network, name), nil
+}
+
+// VersionID implements the `ArtifactSource` interface
+func (m mirror) VersionID(network multichain.Network, name string) (string, error) {
+	return fileVersionID(m.FileURL(network, name))
+}
+
+// LatestRelease implements the `ArtifactSource` interface
+func (m mirror) LatestRelease(network multichain.Network) (string, error) {
+	body, err := fetch(fmt.Sprintf("%v/releases/latest-%v", m.base, network))
+	if err != nil {
+		return "", fmt.Errorf("cannot get latest release of %v, err = %v", network, err)
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	tag := strings.TrimSpace(string(data))
+	if tag == "" {
+		return "", fmt.Errorf("cannot find any release for %v", network)
+	}
+	return tag, nil
+}
+
+// BinaryURL implements the `ArtifactSource` interface
+func (m mirror) BinaryURL(tag string) string {
+	return fmt.Sprintf("%v/releases/%v/darknode", m.base, tag)
+}
+
+// BinaryChecksum implements the `ArtifactSource` interface
+func (m mirror) BinaryChecksum(tag string) (string, error) {
+	body, err := fetch(ChecksumName(m.BinaryURL(tag)))
+	if err != nil {
+		return "", fmt.Errorf("cannot get checksum of release [%v], err = %v", tag, err)
+	}
+	defer body.Close()
+	checksum, err := parseChecksum(body, "darknode")
+	if err != nil {
+		return "", fmt.Errorf("invalid checksum of release [%v], err = %v", tag, err)
+	}
+	return checksum, nil
+}
+
+// UpdaterURL implements the `ArtifactSource` interface
+func (m mirror) UpdaterURL() string {
+	return fmt.Sprintf("%v/releases/darknode-updater", m.base)
+}
+
+// s3Source is an S3-compatible bucket, addressed with path-style urls. Unlike
+// other mirrors, any version of the files can be used if the bucket has
+// versioning enabled.
+type s3Source struct {
+	mirror
+}
+
+// VersionURL implements the `ArtifactSource` interface
+func (source s3Source) VersionURL(network multichain.Network, name, versionID string) (string, error) {
+	return s3VersionURL(source.FileURL(network, name), versionID), nil
+}
+
+// String implements the `ArtifactSource` interface
+func (source s3Source) String() string {
+	return "s3+" + source.base
+}
+
+// httpSource is a plain HTTPS mirror.
+type httpSource struct {
+	mirror
+}
+
+// String implements the `ArtifactSource` interface
+func (source httpSource) String() string {
+	return source.base
+}
+
+// localSource is a local directory. It's read on whichever machine fetches the
+// artifacts, so it needs to exist on both the darknode and the machine running
+// nodectl, i.e. a shared mount.
+type localSource struct {
+	mirror
+}
+
+// String implements the `ArtifactSource` interface
+func (source localSource) String() string {
+	return source.base
+}
+
+// s3VersionURL returns the url of the given version of the S3 object.
+func s3VersionURL(url, versionID string) string {
+	if versionID == "" {
+		return url
+	}
+	return fmt.Sprintf("%v?versionId=%v", url, neturl.QueryEscape(versionID))
+}
+
+// fileVersionID returns the version ID of the file at the url. It's the S3
+// version ID if the server keeps versions, otherwise the ETag or the
+// modification time of the file.
+func fileVersionID(url string) (string, error) {
+	response, err := httpClient(url).Head(url)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot find %v, code = %v", url, response.StatusCode)
+	}
+	if id := response.Header.Get("x-amz-version-id"); id != "" && id != "null" {
+		return id, nil
+	}
+	if etag := strings.Trim(strings.TrimPrefix(response.Header.Get("ETag"), "W/"), `"`); etag != "" {
+		return etag, nil
+	}
+	if modified, err := http.ParseTime(response.Header.Get("Last-Modified")); err == nil {
+		return modified.UTC().Format("20060102T150405Z"), nil
+	}
+	return "", fmt.Errorf("%v doesn't have a version", url)
+}
+
+// fetch returns the body of the url if the request succeeds.
+func fetch(url string) (io.ReadCloser, error) {
+	response, err := httpClient(url).Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyStatusCode(response, http.StatusOK); err != nil {
+		response.Body.Close()
+		return nil, err
+	}
+	return response.Body, nil
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/renproject/multichain"
+)
+
+func TestParseArtifactSource(t *testing.T) {
+	tests := []struct {
+		spec    string
+		valid   bool
+		kind    ArtifactSource
+		str     string
+		fileURL string
+	}{
+		{"", true, publicSource{}, "public", "https://s3.ap-southeast-1.amazonaws.com/darknode.renproject.io/mainnet/config.json"},
+		{"public", true, publicSource{}, "public", "https://s3.ap-southeast-1.amazonaws.com/darknode.renproject.io/mainnet/config.json"},
+		{"s3+https://minio.example.com/darknode/", true, s3Source{}, "s3+https://minio.example.com/darknode", "https://minio.example.com/darknode/mainnet/config.json"},
+		{"s3+http://localhost:9000/bucket", true, s3Source{}, "s3+http://localhost:9000/bucket", "http://localhost:9000/bucket/mainnet/config.json"},
+		{"https://mirror.example.com/ren", true, httpSource{}, "https://mirror.example.com/ren", "https://mirror.example.com/ren/mainnet/config.json"},
+		{"file:///srv/ren/", true, localSource{}, "file:///srv/ren", "file:///srv/ren/mainnet/config.json"},
+		{"/srv/ren", true, localSource{}, "file:///srv/ren", "file:///srv/ren/mainnet/config.json"},
+		{"s3+https://minio.example.com", false, nil, "", ""},
+		{"s3+https:///bucket", false, nil, "", ""},
+		{"https://", false, nil, "", ""},
+		{"file://host/srv/ren", false, nil, "", ""},
+		{"relative/path", false, nil, "", ""},
+		{"ftp://mirror.example.com", false, nil, "", ""},
+	}
+	for _, test := range tests {
+		source, err := ParseArtifactSource(test.spec)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("ParseArtifactSource(%q) expected error, got %v", test.spec, source)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseArtifactSource(%q) returned error: %v", test.spec, err)
+			continue
+		}
+		if reflect.TypeOf(source) != reflect.TypeOf(test.kind) {
+			t.Errorf("ParseArtifactSource(%q) = %T, want %T", test.spec, source, test.kind)
+		}
+		if source.String() != test.str {
+			t.Errorf("ParseArtifactSource(%q).String() = %q, want %q", test.spec, source.String(), test.str)
+		}
+		if got := source.FileURL(multichain.NetworkMainnet, "config.json"); got != test.fileURL {
+			t.Errorf("ParseArtifactSource(%q).FileURL() = %q, want %q", test.spec, got, test.fileURL)
+		}
+
+		// The spec round trips, as it's stored in the metadata and on the
+		// darknode
+		again, err := ParseArtifactSource(source.String())
+		if err != nil || again.String() != source.String() {
+			t.Errorf("cannot parse %q back, got %v, err = %v", source.String(), again, err)
+		}
+	}
+}
+
+func TestLocalSource(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "testnet"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "testnet", "config.json"), []byte(`{"net":"testnet"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	source, err := ParseArtifactSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options, err := OptionTemplate(source, multichain.NetworkTestnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.Network != multichain.NetworkTestnet {
+		t.Errorf("network = %v, want testnet", options.Network)
+	}
+	if _, err := source.VersionID(multichain.NetworkTestnet, "config.json"); err != nil {
+		t.Errorf("cannot get version of local file, err = %v", err)
+	}
+	if _, err := OptionTemplate(source, multichain.NetworkMainnet); err == nil {
+		t.Error("expected error for missing file")
+	}
+
+	// Local files are not readable through the default client
+	if _, err := http.Get(source.FileURL(multichain.NetworkTestnet, "config.json")); err == nil {
+		t.Error("default http client can read local files")
+	}
+}
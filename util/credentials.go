@@ -0,0 +1,267 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// NodeCredentials are the cloud credentials used for managing the resources of
+// a darknode. They are kept outside the darknode folder and passed to terraform
+// through environment variables, so they never end up in the terraform files.
+//
+// AWS credentials are either a pair of static keys with an optional session
+// token, or the name of a profile in the shared AWS config. A role can be
+// assumed on top of both.
+//
+// Credentials taken from a stored credential profile keep the name of the
+// profile, so only the reference is written to the credentials file of the
+// darknode and the profile stays the only encrypted copy.
+type NodeCredentials struct {
+	Profile         string `json:"profile,omitempty"`
+	AwsAccessKey    string `json:"awsAccessKey,omitempty"`
+	AwsSecretKey    string `json:"awsSecretKey,omitempty"`
+	AwsSessionToken string `json:"awsSessionToken,omitempty"`
+	AwsProfile      string `json:"awsProfile,omitempty"`
+	AwsRoleArn      string `json:"awsRoleArn,omitempty"`
+	AwsExternalID   string `json:"awsExternalId,omitempty"`
+	AwsMFASerial    string `json:"awsMfaSerial,omitempty"`
+	DoToken         string `json:"doToken,omitempty"`
+	GcpCredFile     string `json:"gcpCredFile,omitempty"`
+}
+
+// Empty returns whether no credential is set.
+func (creds NodeCredentials) Empty() bool {
+	return creds == NodeCredentials{}
+}
+
+// Env returns the environment variables which provide the credentials to the
+// terraform providers. AWS profiles and roles need to be resolved to static
+// keys beforehand.
+func (creds NodeCredentials) Env() []string {
+	env := make([]string, 0)
+	if creds.AwsAccessKey != "" {
+		env = append(env,
+			"AWS_ACCESS_KEY_ID="+creds.AwsAccessKey,
+			"AWS_SECRET_ACCESS_KEY="+creds.AwsSecretKey,
+			// Make sure a session token from the shell is not mixed up with
+			// our keys
+			"AWS_SESSION_TOKEN="+creds.AwsSessionToken,
+		)
+	}
+	if creds.DoToken != "" {
+		env = append(env, "DIGITALOCEAN_TOKEN="+creds.DoToken)
+	}
+	if creds.GcpCredFile != "" {
+		env = append(env, "GOOGLE_CREDENTIALS="+creds.GcpCredFile)
+	}
+	return env
+}
+
+// NodeCredentialsPath returns the path of the credentials file of the darknode
+// with given name.
+func NodeCredentialsPath(name string) string {
+	return filepath.Join(Directory, "secrets", name+".json")
+}
+
+// ReadNodeCredentials reads the credentials of the darknode with given name.
+// Empty credentials are returned if the darknode doesn't have any, i.e. it's
+// deployed on an existing server.
+func ReadNodeCredentials(name string) (NodeCredentials, error) {
+	var creds NodeCredentials
+	data, err := ioutil.ReadFile(NodeCredentialsPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return creds, nil
+		}
+		return creds, err
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return creds, err
+	}
+	if creds.Profile == "" {
+		return creds, nil
+	}
+
+	// Decrypt the credentials from the referenced profile
+	profile, err := ReadCredentialProfile(creds.Profile)
+	if err != nil {
+		return NodeCredentials{}, fmt.Errorf("cannot read credential profile [%v], err = %v", creds.Profile, err)
+	}
+	stored := profile.Credentials
+	stored.Profile = creds.Profile
+	if creds.AwsRoleArn != "" {
+		stored.AwsRoleArn = creds.AwsRoleArn
+		stored.AwsExternalID = creds.AwsExternalID
+		stored.AwsMFASerial = creds.AwsMFASerial
+	}
+	return stored, nil
+}
+
+// WriteNodeCredentials writes the credentials of the darknode with given name,
+// which is only readable by the current user. Credentials from a stored profile
+// are written as a reference to the profile.
+func WriteNodeCredentials(name string, creds NodeCredentials) error {
+	if creds.Profile != "" {
+		creds = NodeCredentials{
+			Profile:       creds.Profile,
+			AwsRoleArn:    creds.AwsRoleArn,
+			AwsExternalID: creds.AwsExternalID,
+			AwsMFASerial:  creds.AwsMFASerial,
+		}
+	}
+	path := NodeCredentialsPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(creds, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// RemoveNodeCredentials removes the credentials of the darknode with given
+// name.
+func RemoveNodeCredentials(name string) error {
+	err := os.Remove(NodeCredentialsPath(name))
+	if err != nil && os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// ErrProfileNotFound is returned when the credential profile doesn't exist.
+var ErrProfileNotFound = errors.New("credential profile not found")
+
+// profileNameRegex is the naming requirement for credential profiles.
+var profileNameRegex = regexp.MustCompile("^[a-zA-Z0-9_-]{1,32}$")
+
+// CredentialProfile is a named set of cloud credentials of a provider, which
+// can be used for deploying darknodes. The credentials are kept encrypted.
+type CredentialProfile struct {
+	Name        string          `json:"name"`
+	Provider    string          `json:"provider"`
+	Credentials NodeCredentials `json:"-"`
+}
+
+// credentialProfileFile is the format of the credential profile file.
+type credentialProfileFile struct {
+	Name     string   `json:"name"`
+	Provider string   `json:"provider"`
+	Keystore keystore `json:"keystore"`
+}
+
+// CredentialProfilePath returns the path of the credential profile with given
+// name.
+func CredentialProfilePath(name string) string {
+	return filepath.Join(Directory, "credentials", name+".json")
+}
+
+// WriteCredentialProfile encrypts the credentials of the profile and writes
+// it to the profile file.
+func WriteCredentialProfile(profile CredentialProfile) error {
+	if !profileNameRegex.MatchString(profile.Name) {
+		return fmt.Errorf("profile name should be less than 32 characters and not contain any special character")
+	}
+	// A profile cannot refer to another profile
+	creds := profile.Credentials
+	creds.Profile = ""
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	ks, err := sealKeystore(data)
+	if err != nil {
+		return err
+	}
+	file := credentialProfileFile{
+		Name:     profile.Name,
+		Provider: profile.Provider,
+		Keystore: ks,
+	}
+	fileData, err := json.MarshalIndent(file, "", "    ")
+	if err != nil {
+		return err
+	}
+	path := CredentialProfilePath(profile.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, fileData)
+}
+
+// readCredentialProfileFile reads the profile file without decrypting the
+// credentials.
+func readCredentialProfileFile(name string) (credentialProfileFile, error) {
+	var file credentialProfileFile
+	if !profileNameRegex.MatchString(name) {
+		return file, fmt.Errorf("%w: %v", ErrProfileNotFound, name)
+	}
+	data, err := ioutil.ReadFile(CredentialProfilePath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return file, fmt.Errorf("%w: %v", ErrProfileNotFound, name)
+		}
+		return file, err
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("invalid credential profile, err = %v", err)
+	}
+	return file, nil
+}
+
+// ReadCredentialProfile reads the credential profile with given name and
+// decrypts its credentials.
+func ReadCredentialProfile(name string) (CredentialProfile, error) {
+	file, err := readCredentialProfileFile(name)
+	if err != nil {
+		return CredentialProfile{}, err
+	}
+	plaintext, err := file.Keystore.open()
+	if err != nil {
+		return CredentialProfile{}, err
+	}
+	profile := CredentialProfile{
+		Name:     file.Name,
+		Provider: file.Provider,
+	}
+	if err := json.Unmarshal(plaintext, &profile.Credentials); err != nil {
+		return CredentialProfile{}, err
+	}
+	return profile, nil
+}
+
+// ListCredentialProfiles returns all the credential profiles, without
+// decrypting their credentials.
+func ListCredentialProfiles() ([]CredentialProfile, error) {
+	files, err := filepath.Glob(filepath.Join(Directory, "credentials", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]CredentialProfile, 0, len(files))
+	for _, path := range files {
+		file, err := readCredentialProfileFile(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, CredentialProfile{
+			Name:     file.Name,
+			Provider: file.Provider,
+		})
+	}
+	return profiles, nil
+}
+
+// RemoveCredentialProfile removes the credential profile with given name.
+func RemoveCredentialProfile(name string) error {
+	if _, err := readCredentialProfileFile(name); err != nil {
+		return err
+	}
+	return os.Remove(CredentialProfilePath(name))
+}
@@ -1,12 +1,16 @@
 package util
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v44/github"
@@ -43,6 +47,59 @@ func RateLimit(ctx context.Context, client *github.Client) (int, error) {
 	return rl.Core.Remaining, nil
 }
 
+// releaseRegex matches the tag of a darknode release and captures the version,
+// network and index, i.e. "0.4.10-mainnet12" -> ["0.4.10-mainnet12", "0.4.10",
+// ".10", "mainnet", "12"]
+var releaseRegex = regexp.MustCompile("^(\\d+.\\d+(.\\d+)?)-(mainnet|testnet|devnet)(\\d+)$")
+
+// CompareVersions compares two darknode versions. It returns -1, 0 or 1 if the
+// first version is older than, the same as or newer than the second one. The
+// index of release tags is compared as a number, so "0.4.10-mainnet10" is newer
+// than "0.4.10-mainnet9".
+func CompareVersions(ver1, ver2 string) (int, error) {
+	m1 := releaseRegex.FindStringSubmatch(ver1)
+	m2 := releaseRegex.FindStringSubmatch(ver2)
+	if m1 == nil || m2 == nil || m1[3] != m2[3] {
+		v1, err := version.NewVersion(ver1)
+		if err != nil {
+			return 0, err
+		}
+		v2, err := version.NewVersion(ver2)
+		if err != nil {
+			return 0, err
+		}
+		return v1.Compare(v2), nil
+	}
+
+	v1, err := version.NewVersion(m1[1])
+	if err != nil {
+		return 0, err
+	}
+	v2, err := version.NewVersion(m2[1])
+	if err != nil {
+		return 0, err
+	}
+	if res := v1.Compare(v2); res != 0 {
+		return res, nil
+	}
+	index1, err := strconv.Atoi(m1[4])
+	if err != nil {
+		return 0, err
+	}
+	index2, err := strconv.Atoi(m2[4])
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case index1 < index2:
+		return -1, nil
+	case index1 > index2:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
 // LatestRelease fetches the name of the latest Darknode release of given
 // network.
 func LatestRelease(network multichain.Network) (string, error) {
@@ -59,8 +116,6 @@ func LatestRelease(network multichain.Network) (string, error) {
 		return "", fmt.Errorf("rate limited by github API, please set the env `GITHUB_TOKEN` with a personal access token")
 	}
 
-	// Construct the regex for release name
-	reg := regexp.MustCompile("^(\\d+.\\d+(.\\d+)?)-(mainnet|testnet|devnet)(\\d+)$")
 	maxIndex := 0
 	maxVersion, _ := version.NewVersion("0.0.0")
 	tag := ""
@@ -84,8 +139,8 @@ func LatestRelease(network multichain.Network) (string, error) {
 		for _, release := range releases {
 			// Parse version, network, index from the release tag name
 			// i.e. "0.4.10-mainnet12"  -> ["0.4.10-mainnet12", "0.4.10", ".10", "mainnet", "12"]
-			matches := reg.FindStringSubmatch(*release.TagName)
-			if len(matches) != reg.NumSubexp()+1 {
+			matches := releaseRegex.FindStringSubmatch(*release.TagName)
+			if len(matches) != releaseRegex.NumSubexp()+1 {
 				continue
 			}
 
@@ -129,3 +184,92 @@ func LatestRelease(network multichain.Network) (string, error) {
 	}
 	return tag, nil
 }
+
+// checksumAssets are the names of the release assets which may contain the
+// sha256 checksum of the darknode binary.
+var checksumAssets = []string{"darknode.sha256", "darknode.sha256sum", "sha256sums", "sha256sums.txt", "checksums.txt"}
+
+// sha256Regex matches a hex encoded sha256 checksum.
+var sha256Regex = regexp.MustCompile("^[0-9a-fA-F]{64}$")
+
+// darknodeChecksums caches the checksums of the darknode releases, so they're
+// only fetched once for updating many darknodes.
+var (
+	darknodeChecksumsMu = new(sync.Mutex)
+	darknodeChecksums   = map[string]string{}
+)
+
+// DarknodeChecksum fetches the sha256 checksum of the darknode binary from the
+// assets of the release with given tag.
+func DarknodeChecksum(tag string) (string, error) {
+	darknodeChecksumsMu.Lock()
+	defer darknodeChecksumsMu.Unlock()
+
+	if checksum, ok := darknodeChecksums[tag]; ok {
+		return checksum, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client := GithubClient(ctx)
+	release, response, err := client.Repositories.GetReleaseByTag(ctx, "renproject", "darknode-release", tag)
+	if err != nil {
+		return "", fmt.Errorf("cannot get release [%v], err = %v", tag, err)
+	}
+	if err := VerifyStatusCode(response.Response, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	for _, asset := range release.Assets {
+		if !isChecksumAsset(asset.GetName()) {
+			continue
+		}
+		rc, _, err := client.Repositories.DownloadReleaseAsset(ctx, "renproject", "darknode-release", asset.GetID(), http.DefaultClient)
+		if err != nil {
+			return "", fmt.Errorf("cannot download %v of release [%v], err = %v", asset.GetName(), tag, err)
+		}
+		checksum, err := parseChecksum(rc, "darknode")
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("invalid %v of release [%v], err = %v", asset.GetName(), tag, err)
+		}
+		darknodeChecksums[tag] = checksum
+		return checksum, nil
+	}
+	return "", fmt.Errorf("release [%v] doesn't publish a checksum of the darknode binary", tag)
+}
+
+func isChecksumAsset(name string) bool {
+	for _, asset := range checksumAssets {
+		if strings.EqualFold(name, asset) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseChecksum finds the checksum of the file with given name, in the format
+// of sha256sum. A single checksum without file name is also accepted.
+func parseChecksum(r io.Reader, filename string) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !sha256Regex.MatchString(fields[0]) {
+			continue
+		}
+		if len(fields) == 1 || strings.TrimPrefix(fields[1], "*") == filename {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no checksum for %v", filename)
+}
+
+// VerifyChecksumScript returns the script which checks the sha256 checksum of
+// the file. The file is removed and the script exits with an error if it
+// doesn't match.
+func VerifyChecksumScript(path, checksum string) string {
+	return fmt.Sprintf(`{ echo "%v  %v" | sha256sum --check --status || { rm -f %v; echo "checksum of %v doesn't match, refusing to install it" >&2; exit 1; }; }`, checksum, path, path, path)
+}
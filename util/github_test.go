@@ -0,0 +1,30 @@
+package util
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		ver1, ver2 string
+		res        int
+	}{
+		{"0.4.10-mainnet10", "0.4.10-mainnet9", 1},
+		{"0.4.10-mainnet9", "0.4.10-mainnet10", -1},
+		{"0.4.10-mainnet12", "0.4.10-mainnet12", 0},
+		{"0.4.10-testnet2", "0.4.9-testnet20", 1},
+		{"0.4-devnet1", "0.4.0-devnet1", 0},
+		{"1.2.3", "1.10.0", -1},
+	}
+	for _, test := range tests {
+		res, err := CompareVersions(test.ver1, test.ver2)
+		if err != nil {
+			t.Fatalf("CompareVersions(%q, %q) returned error: %v", test.ver1, test.ver2, err)
+		}
+		if res != test.res {
+			t.Errorf("CompareVersions(%q, %q) = %v, want %v", test.ver1, test.ver2, res, test.res)
+		}
+	}
+
+	if _, err := CompareVersions("not-a-version", "0.4.10-mainnet1"); err == nil {
+		t.Error("expected error for an invalid version")
+	}
+}
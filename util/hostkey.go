@@ -0,0 +1,93 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ErrHostKeyChanged is returned when the host key of the instance doesn't
+// match the one we recorded.
+var ErrHostKeyChanged = errors.New("host key has changed, someone could be eavesdropping on the connection")
+
+// errHostKeyFetched is used to abort the handshake once we get the host key.
+var errHostKeyFetched = errors.New("host key fetched")
+
+// hostKeyMu prevents concurrent connections from recording the host key of the
+// same node at the same time.
+var hostKeyMu = new(sync.Mutex)
+
+// KnownHostsPath returns the path of the file which pins the host key of the
+// instance of given node. It's in the format of OpenSSH known_hosts file.
+func KnownHostsPath(name string) string {
+	return filepath.Join(NodePath(name), "known_hosts")
+}
+
+// HostKeyCallback verifies the host key of the instance against the pinned
+// one. The host key is recorded on the first connection to the instance, which
+// happens while deploying the node.
+func HostKeyCallback(name string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKeyMu.Lock()
+		defer hostKeyMu.Unlock()
+
+		path := KnownHostsPath(name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return PinHostKey(name, key)
+		}
+		callback, err := knownhosts.New(path)
+		if err != nil {
+			return fmt.Errorf("cannot read known hosts file, err = %v", err)
+		}
+		if err := callback(hostname, remote, key); err != nil {
+			var keyErr *knownhosts.KeyError
+			if errors.As(err, &keyErr) {
+				return fmt.Errorf("%w, run `nodectl ssh rekey %v` if the change is expected", ErrHostKeyChanged, name)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// PinHostKey records the host key of the instance of given node, replacing any
+// host key recorded before.
+func PinHostKey(name string, key ssh.PublicKey) error {
+	ip, err := NodeIP(name)
+	if err != nil {
+		return err
+	}
+	line := knownhosts.Line([]string{knownhosts.Normalize(ip)}, key)
+	return ioutil.WriteFile(KnownHostsPath(name), []byte(line+"\n"), 0600)
+}
+
+// FetchHostKey returns the current host key of the instance of given node
+// without verifying it.
+func FetchHostKey(name string) (ssh.PublicKey, error) {
+	ip, err := NodeIP(name)
+	if err != nil {
+		return nil, err
+	}
+	var hostKey ssh.PublicKey
+	config := ssh.ClientConfig{
+		User:    "darknode",
+		Timeout: 10 * time.Second,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return errHostKeyFetched
+		},
+	}
+	_, err = ssh.Dial("tcp", fmt.Sprintf("%v:22", ip), &config)
+	if hostKey == nil {
+		return nil, fmt.Errorf("cannot fetch host key, err = %v", err)
+	}
+	return hostKey, nil
+}
@@ -60,3 +60,18 @@ func ParseSshPrivateKey(name string) (ssh.Signer, error) {
 	}
 	return ssh.ParsePrivateKey(sshKey)
 }
+
+// SshPubKeyFingerprint returns the MD5 fingerprint of the public ssh key of
+// the node, in the colon-separated hex form used by cloud providers.
+func SshPubKeyFingerprint(name string) (string, error) {
+	path := filepath.Join(NodePath(name), "ssh_keypair.pub")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return "", err
+	}
+	return ssh.FingerprintLegacyMD5(key), nil
+}
@@ -0,0 +1,320 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/renproject/nodectl/renvm"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// PassphraseEnv is the environment variable which can be used to provide the
+// keystore passphrase without interactive prompts.
+const PassphraseEnv = "NODECTL_PASSPHRASE"
+
+// Parameters of the scrypt key derivation.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+var (
+	// ErrWrongPassphrase is returned when the keystore cannot be decrypted
+	// with the given passphrase.
+	ErrWrongPassphrase = errors.New("cannot decrypt the keystore, wrong passphrase")
+
+	// ErrNotEncrypted is returned when decrypting a config which is not
+	// encrypted.
+	ErrNotEncrypted = errors.New("config is not encrypted")
+)
+
+// passphrase is cached once unlocked, so the user only needs to enter it once
+// in a session.
+var (
+	passphraseMu sync.Mutex
+	passphrase   []byte
+)
+
+// keystore is the format of the encrypted config file.
+type keystore struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// NodeEncryptedConfigPath returns the path of the encrypted config file of the
+// given darknode.
+func NodeEncryptedConfigPath(name string) string {
+	return filepath.Join(NodePath(name), "config.json.enc")
+}
+
+// NodeConfigEncrypted returns whether the config of the node is encrypted.
+func NodeConfigEncrypted(name string) bool {
+	_, err := os.Stat(NodeEncryptedConfigPath(name))
+	return err == nil
+}
+
+// Passphrase returns the keystore passphrase. It's read from the environment
+// variable or prompted from the terminal if not set. The user is asked to
+// enter it twice if confirm is true.
+func Passphrase(confirm bool) ([]byte, error) {
+	passphraseMu.Lock()
+	defer passphraseMu.Unlock()
+
+	if passphrase != nil {
+		return passphrase, nil
+	}
+	if env := os.Getenv(PassphraseEnv); env != "" {
+		passphrase = []byte(env)
+		return passphrase, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("cannot prompt for passphrase, please set %v", PassphraseEnv)
+	}
+
+	fmt.Print("Enter keystore passphrase: ")
+	input, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return nil, err
+	}
+	if len(input) == 0 {
+		return nil, errors.New("passphrase cannot be empty")
+	}
+	if confirm {
+		fmt.Print("Confirm keystore passphrase: ")
+		again, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return nil, err
+		}
+		if string(input) != string(again) {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+	passphrase = input
+	return passphrase, nil
+}
+
+// sealKeystore encrypts the data with a key derived from the passphrase.
+func sealKeystore(data []byte) (keystore, error) {
+	pass, err := Passphrase(true)
+	if err != nil {
+		return keystore{}, err
+	}
+	ks := keystore{
+		Version: 1,
+		KDF:     "scrypt",
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    make([]byte, 32),
+		Nonce:   make([]byte, 24),
+	}
+	if _, err := io.ReadFull(rand.Reader, ks.Salt); err != nil {
+		return keystore{}, err
+	}
+	if _, err := io.ReadFull(rand.Reader, ks.Nonce); err != nil {
+		return keystore{}, err
+	}
+	key, err := scrypt.Key(pass, ks.Salt, ks.N, ks.R, ks.P, scryptKeyLen)
+	if err != nil {
+		return keystore{}, err
+	}
+	var secretKey [32]byte
+	var nonce [24]byte
+	copy(secretKey[:], key)
+	copy(nonce[:], ks.Nonce)
+	ks.Ciphertext = secretbox.Seal(nil, data, &nonce, &secretKey)
+	return ks, nil
+}
+
+// open decrypts the data in the keystore with the passphrase.
+func (ks keystore) open() ([]byte, error) {
+	if ks.Version != 1 || ks.KDF != "scrypt" || len(ks.Nonce) != 24 {
+		return nil, fmt.Errorf("unsupported keystore version %v", ks.Version)
+	}
+	pass, err := Passphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key(pass, ks.Salt, ks.N, ks.R, ks.P, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	var secretKey [32]byte
+	var nonce [24]byte
+	copy(secretKey[:], key)
+	copy(nonce[:], ks.Nonce)
+	plaintext, ok := secretbox.Open(nil, ks.Ciphertext, &nonce, &secretKey)
+	if !ok {
+		// Forget the passphrase so the user can try again
+		passphraseMu.Lock()
+		passphrase = nil
+		passphraseMu.Unlock()
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+// writeFileAtomic writes the data to a temporary file which then replaces the
+// given file, so the file is never left half-written.
+func writeFileAtomic(path string, data []byte) error {
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// EncryptNodeOptions writes the options of the node into the encrypted config
+// file and removes the plaintext one.
+func EncryptNodeOptions(name string, options renvm.Options) error {
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	ks, err := sealKeystore(data)
+	if err != nil {
+		return err
+	}
+	ksData, err := json.MarshalIndent(ks, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(NodeEncryptedConfigPath(name), ksData); err != nil {
+		return err
+	}
+	if err := removePlaintextConfig(NodeConfigPath(name)); err != nil {
+		return err
+	}
+	return EncryptConfigBackup(name)
+}
+
+// PlaintextConfigBackups returns the names of the darknodes, including the
+// destroyed ones, which have a plaintext config in the backup folder.
+func PlaintextConfigBackups() ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(Directory, "backup"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(Directory, "backup", f.Name(), "config.json")); err == nil {
+			names = append(names, f.Name())
+		}
+	}
+	return names, nil
+}
+
+// EncryptConfigBackup encrypts the plaintext config in the backup folder of
+// the darknode and removes the plaintext one.
+func EncryptConfigBackup(name string) error {
+	backupFolder := filepath.Join(Directory, "backup", name)
+	plaintext := filepath.Join(backupFolder, "config.json")
+	data, err := ioutil.ReadFile(plaintext)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	ks, err := sealKeystore(data)
+	if err != nil {
+		return err
+	}
+	ksData, err := json.MarshalIndent(ks, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(backupFolder, "config.json.enc"), ksData); err != nil {
+		return err
+	}
+	return removePlaintextConfig(plaintext)
+}
+
+// removePlaintextConfig deletes the plaintext config file. If it cannot be
+// deleted, the file is at least made readable only by the owner.
+func removePlaintextConfig(path string) error {
+	err := os.Remove(path)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+	if chmodErr := os.Chmod(path, 0600); chmodErr != nil {
+		return fmt.Errorf("cannot remove %v, err = %v", path, chmodErr)
+	}
+	return fmt.Errorf("cannot remove %v, err = %v", path, err)
+}
+
+// DecryptNodeOptions reads the options of the node from the encrypted config
+// file.
+func DecryptNodeOptions(name string) (renvm.Options, error) {
+	data, err := ioutil.ReadFile(NodeEncryptedConfigPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return renvm.Options{}, ErrNotEncrypted
+		}
+		return renvm.Options{}, err
+	}
+	var ks keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return renvm.Options{}, fmt.Errorf("invalid keystore, err = %v", err)
+	}
+	plaintext, err := ks.open()
+	if err != nil {
+		return renvm.Options{}, err
+	}
+
+	var options renvm.Options
+	if err := json.Unmarshal(plaintext, &options); err != nil {
+		return renvm.Options{}, err
+	}
+	return options, nil
+}
+
+// DecryptNodeConfig converts the encrypted config of the node back to the
+// plaintext config file.
+func DecryptNodeConfig(name string) error {
+	options, err := DecryptNodeOptions(name)
+	if err != nil {
+		return err
+	}
+	if err := renvm.OptionsToFile(options, NodeConfigPath(name)); err != nil {
+		return err
+	}
+	return os.Remove(NodeEncryptedConfigPath(name))
+}
+
+// WriteNodeOptions writes the options of the node. The config stays encrypted
+// if it has been encrypted.
+func WriteNodeOptions(name string, options renvm.Options) error {
+	if NodeConfigEncrypted(name) {
+		// Make sure we use the same passphrase as before
+		if _, err := DecryptNodeOptions(name); err != nil {
+			return err
+		}
+		return EncryptNodeOptions(name, options)
+	}
+	return renvm.OptionsToFile(options, NodeConfigPath(name))
+}
@@ -0,0 +1,151 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/renproject/multichain"
+	"github.com/renproject/nodectl/renvm"
+)
+
+// setPassphrase provides the keystore passphrase and forgets the cached one.
+func setPassphrase(t *testing.T, pass string) {
+	old, ok := os.LookupEnv(PassphraseEnv)
+	os.Setenv(PassphraseEnv, pass)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(PassphraseEnv, old)
+		} else {
+			os.Unsetenv(PassphraseEnv)
+		}
+	})
+	passphraseMu.Lock()
+	passphrase = nil
+	passphraseMu.Unlock()
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	Directory = t.TempDir()
+	name := "my-node"
+	if err := os.MkdirAll(NodePath(name), 0700); err != nil {
+		t.Fatal(err)
+	}
+	setPassphrase(t, "correct horse battery staple")
+
+	options := renvm.Options{
+		Network: multichain.NetworkTestnet,
+		Home:    renvm.DefaultHome,
+		Port:    renvm.DefaultPort,
+	}
+	if err := renvm.OptionsToFile(options, NodeConfigPath(name)); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptNodeOptions(name, options); err != nil {
+		t.Fatal(err)
+	}
+	if !NodeConfigEncrypted(name) {
+		t.Fatal("config is not encrypted")
+	}
+	if _, err := os.Stat(NodeConfigPath(name)); !os.IsNotExist(err) {
+		t.Fatalf("plaintext config is not removed, err = %v", err)
+	}
+	info, err := os.Stat(NodeEncryptedConfigPath(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("encrypted config has mode %v, want 0600", info.Mode().Perm())
+	}
+
+	decrypted, err := DecryptNodeOptions(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(mustMarshal(t, decrypted), mustMarshal(t, options)) {
+		t.Errorf("decrypted options don't match, got = %+v, want = %+v", decrypted, options)
+	}
+
+	// A wrong passphrase is rejected and not cached
+	setPassphrase(t, "wrong passphrase")
+	if _, err := DecryptNodeOptions(name); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected ErrWrongPassphrase, got %v", err)
+	}
+
+	// Decrypting converts it back to the plaintext config
+	setPassphrase(t, "correct horse battery staple")
+	if err := DecryptNodeConfig(name); err != nil {
+		t.Fatal(err)
+	}
+	if NodeConfigEncrypted(name) {
+		t.Error("config is still encrypted")
+	}
+	if _, err := DecryptNodeOptions(name); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("expected ErrNotEncrypted, got %v", err)
+	}
+}
+
+func TestEncryptConfigBackup(t *testing.T) {
+	Directory = t.TempDir()
+	setPassphrase(t, "correct horse battery staple")
+
+	// Backup of a destroyed darknode, written by an older version
+	name := "destroyed-node"
+	backupFolder := filepath.Join(Directory, "backup", name)
+	if err := os.MkdirAll(backupFolder, 0700); err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte(`{"network":"testnet"}`)
+	if err := ioutil.WriteFile(filepath.Join(backupFolder, "config.json"), plaintext, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := PlaintextConfigBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{name}) {
+		t.Fatalf("PlaintextConfigBackups() = %v, want [%v]", names, name)
+	}
+	if err := EncryptConfigBackup(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(backupFolder, "config.json")); !os.IsNotExist(err) {
+		t.Fatalf("plaintext backup is not removed, err = %v", err)
+	}
+	names, err = PlaintextConfigBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("PlaintextConfigBackups() = %v after encryption, want none", names)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(backupFolder, "config.json.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ks keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := ks.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != string(plaintext) {
+		t.Errorf("decrypted backup = %s, want %s", decrypted, plaintext)
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,110 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/renproject/multichain"
+)
+
+// NodeMetadata is the details of a node which are recorded when it's deployed,
+// so that we don't need to query terraform every time we need them.
+type NodeMetadata struct {
+	Name           string             `json:"name"`
+	Provider       string             `json:"provider"`
+	Region         string             `json:"region"`
+	Instance       string             `json:"instance"`
+	IP             string             `json:"ip"`
+	User           string             `json:"user"`
+	SudoUser       string             `json:"sudoUser"`
+	Network        multichain.Network `json:"network"`
+	Version        string             `json:"version"`
+	CreatedAt      time.Time          `json:"createdAt"`
+	Tags           []string           `json:"tags"`
+	ArtifactSource string             `json:"artifactSource,omitempty"`
+}
+
+// NodeMetadataPath returns the path of the metadata file of the given node.
+func NodeMetadataPath(name string) string {
+	return filepath.Join(NodePath(name), "node.json")
+}
+
+// ReadNodeMetadata reads the metadata file of the node with given name. It
+// returns an error satisfying os.IsNotExist if the node has not been migrated.
+func ReadNodeMetadata(name string) (NodeMetadata, error) {
+	if name == "" {
+		return NodeMetadata{}, ErrEmptyName
+	}
+	data, err := ioutil.ReadFile(NodeMetadataPath(name))
+	if err != nil {
+		return NodeMetadata{}, err
+	}
+	var meta NodeMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return NodeMetadata{}, fmt.Errorf("invalid metadata file, err = %v", err)
+	}
+	return meta, nil
+}
+
+// WriteNodeMetadata writes the metadata to the node directory. The file is
+// replaced atomically so a crash never leaves a half-written file behind.
+func WriteNodeMetadata(meta NodeMetadata) error {
+	if meta.Name == "" {
+		return ErrEmptyName
+	}
+	data, err := json.MarshalIndent(meta, "", "    ")
+	if err != nil {
+		return err
+	}
+	path := NodeMetadataPath(meta.Name)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// UpdateNodeMetadata applies the update to the metadata of the given node. It
+// does nothing if the node doesn't have a metadata file yet.
+func UpdateNodeMetadata(name string, update func(meta *NodeMetadata)) error {
+	meta, err := ReadNodeMetadata(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	update(&meta)
+	return WriteNodeMetadata(meta)
+}
+
+// ParseTags splits the comma separated tags.
+func ParseTags(tags string) []string {
+	list := make([]string, 0)
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			list = append(list, tag)
+		}
+	}
+	return list
+}
+
+// TerraformOutput returns the value of the terraform output of the given node.
+// It should only be used when the metadata is not available.
+func TerraformOutput(name, key string) (string, error) {
+	cmd := fmt.Sprintf("cd %v && %v output -raw %v", NodePath(name), Terraform, key)
+	output, err := CommandOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("cannot read terraform output %v, err = %v", key, err)
+	}
+	if strings.Contains(output, "Warning") {
+		return "", fmt.Errorf("no output %v", key)
+	}
+	return strings.Trim(strings.TrimSpace(output), "\""), nil
+}
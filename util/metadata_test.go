@@ -0,0 +1,25 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		tags     string
+		expected []string
+	}{
+		{"", []string{}},
+		{"prod", []string{"prod"}},
+		{"prod,eu", []string{"prod", "eu"}},
+		{" prod , eu ", []string{"prod", "eu"}},
+		{"prod,,eu,", []string{"prod", "eu"}},
+		{",, ,", []string{}},
+	}
+	for _, test := range tests {
+		if got := ParseTags(test.tags); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("ParseTags(%q) = %q, want %q", test.tags, got, test.expected)
+		}
+	}
+}
@@ -68,10 +68,13 @@ func NodeExistence(name string) error {
 	return err
 }
 
-// NodeOptions returns the config of the node with given name.
+// NodeOptions returns the config of the node with given name. Encrypted config
+// is decrypted on demand.
 func NodeOptions(name string) (renvm.Options, error) {
-	path := filepath.Join(NodePath(name), "config.json")
-	return renvm.NewOptionsFromFile(path)
+	if NodeConfigEncrypted(name) {
+		return DecryptNodeOptions(name)
+	}
+	return renvm.NewOptionsFromFile(NodeConfigPath(name))
 }
 
 // NodeIP gets the IP address of the node with given name.
@@ -80,18 +83,11 @@ func NodeIP(name string) (string, error) {
 		return "", ErrEmptyName
 	}
 
-	cmd := fmt.Sprintf("cd %v && %v output ip", NodePath(name), Terraform)
-	ip, err := CommandOutput(cmd)
-	if err != nil {
-		return "", err
-	}
-	if strings.Contains(ip, "Warning") {
-		return "", fmt.Errorf("no ouput ip")
-	}
-	if strings.HasPrefix(ip, "\"") {
-		return strings.Trim(strings.TrimSpace(ip), "\""), err
+	meta, err := ReadNodeMetadata(name)
+	if err == nil && meta.IP != "" {
+		return meta.IP, nil
 	}
-	return strings.TrimSpace(ip), nil
+	return TerraformOutput(name, "ip")
 }
 
 // NodeEthereumAddr gets the ethereum address of the node with given name.
@@ -105,23 +101,43 @@ func NodeProvider(name string) (string, error) {
 		return "", ErrEmptyName
 	}
 
-	cmd := fmt.Sprintf("cd %v && %v output provider", NodePath(name), Terraform)
-	provider, err := CommandOutput(cmd)
-	if strings.HasPrefix(provider, "\"") {
-		provider = strings.Trim(strings.TrimSpace(provider), "\"")
+	meta, err := ReadNodeMetadata(name)
+	if err == nil && meta.Provider != "" {
+		return meta.Provider, nil
 	}
-	return strings.TrimSpace(provider), err
+	return TerraformOutput(name, "provider")
 }
 
+// NodeInstanceUser returns the user which runs the darknode on the instance.
 func NodeInstanceUser(name string) string {
-	cmd := fmt.Sprintf("cd %v && %v output instance_user", NodePath(name), Terraform)
-	username, err := CommandOutput(cmd)
-	if err == nil {
-		return strings.Trim(strings.TrimSpace(username), "\"")
+	meta, err := ReadNodeMetadata(name)
+	if err == nil && meta.User != "" {
+		return meta.User
+	}
+	if username, err := TerraformOutput(name, "instance_user"); err == nil {
+		return username
 	}
 	return "darknode"
 }
 
+// NodeTags returns the comma separated tags of the node with given name.
+func NodeTags(name string) (string, error) {
+	meta, err := ReadNodeMetadata(name)
+	if err == nil {
+		return strings.Join(meta.Tags, ","), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	// Fallback to the `tags.out` file if the node has not been migrated.
+	tags, err := ioutil.ReadFile(filepath.Join(NodePath(name), "tags.out"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(tags)), nil
+}
+
 // GetNodesByTags return the names of the nodes which have the given tags.
 func GetNodesByTags(tags string) ([]string, error) {
 	files, err := ioutil.ReadDir(filepath.Join(Directory, "darknodes"))
@@ -130,13 +146,12 @@ func GetNodesByTags(tags string) ([]string, error) {
 	}
 	nodes := make([]string, 0)
 	for _, f := range files {
-		path := filepath.Join(Directory, "darknodes", f.Name(), "tags.out")
-		tagFile, err := ioutil.ReadFile(path)
+		nodeTags, err := NodeTags(f.Name())
 		if err != nil {
-			// If the tags.out file doesn't exist, use empty tags.
-			tagFile = []byte{}
+			// If the node doesn't have any tags file, use empty tags.
+			nodeTags = ""
 		}
-		if !ValidateTags(string(tagFile), tags) {
+		if !ValidateTags(nodeTags, tags) {
 			continue
 		}
 		nodes = append(nodes, f.Name())
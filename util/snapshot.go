@@ -0,0 +1,213 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/renproject/multichain"
+)
+
+// SnapshotManifest describes a published snapshot. It's stored next to the
+// snapshot, with the same name but a `.json` extension.
+type SnapshotManifest struct {
+	Key       string    `json:"key"`
+	Sha256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	Height    uint64    `json:"height"`
+	CreatedAt time.Time `json:"createdAt"`
+	Source    string    `json:"source"`
+}
+
+// SnapshotKey returns the key of the snapshot created at the given time with
+// the given checksum. Snapshots never overwrite each other, as the key is
+// addressed by the content.
+func SnapshotKey(network multichain.Network, createdAt time.Time, checksum string) string {
+	return fmt.Sprintf("%v/snapshots/%v-%v.tar.gz", network, createdAt.UTC().Format("20060102T150405Z"), checksum)
+}
+
+// ManifestName returns the name of the manifest of the snapshot with given
+// name.
+func ManifestName(name string) string {
+	return strings.TrimSuffix(name, ".tar.gz") + ".json"
+}
+
+// ChecksumName returns the name of the sha256 checksum file published
+// alongside the file of given name. It works for both urls and s3 keys.
+func ChecksumName(name string) string {
+	return name + ".sha256"
+}
+
+// FileChecksum returns the hex encoded sha256 checksum of the file.
+func FileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// LatestSnapshot is the name of the latest snapshot file of a network.
+const LatestSnapshot = "latest.tar.gz"
+
+// SnapshotChecksum returns the sha256 checksum of the given version of the
+// snapshot file from the source. It's recorded in the metadata of the snapshot
+// when published. Snapshots published without it can only be verified with
+// the checksum file published alongside, which is for the current version
+// only. The latest snapshot is used if the name is empty.
+func SnapshotChecksum(source ArtifactSource, network multichain.Network, name, versionID string) (string, error) {
+	if name == "" {
+		name = LatestSnapshot
+	}
+	url, err := source.VersionURL(network, name, versionID)
+	if err != nil {
+		return "", err
+	}
+	response, err := httpClient(url).Head(url)
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot find snapshot, code = %v", response.StatusCode)
+	}
+	if checksum := response.Header.Get("x-amz-meta-sha256"); sha256Regex.MatchString(checksum) {
+		return strings.ToLower(checksum), nil
+	}
+
+	if versionID != "" {
+		current, err := source.VersionID(network, name)
+		if err != nil {
+			return "", err
+		}
+		if current != versionID {
+			return "", fmt.Errorf("snapshot version %v was published without a checksum and cannot be verified, use a newer version or a snapshot from `nodectl snapshot list` instead", versionID)
+		}
+	}
+	body, err := fetch(ChecksumName(source.FileURL(network, name)))
+	if err != nil {
+		return "", fmt.Errorf("cannot get snapshot checksum, %v", err)
+	}
+	defer body.Close()
+	checksum, err := parseChecksum(body, path.Base(name))
+	if err != nil {
+		return "", err
+	}
+
+	// The checksum file is replaced separately from the snapshot when a new
+	// one is published. Make sure they describe the same file if there is a
+	// manifest to tell.
+	if manifest, err := fetchManifest(ManifestName(source.FileURL(network, name))); err == nil {
+		size, err := strconv.ParseInt(response.Header.Get("Content-Length"), 10, 64)
+		if manifest.Sha256 != checksum || (err == nil && manifest.Size != size) {
+			return "", fmt.Errorf("snapshot is being published, please try again later")
+		}
+	}
+	return checksum, nil
+}
+
+// fetchManifest downloads and parses the snapshot manifest from the url.
+func fetchManifest(url string) (SnapshotManifest, error) {
+	body, err := fetch(url)
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+	defer body.Close()
+
+	var manifest SnapshotManifest
+	err = json.NewDecoder(body).Decode(&manifest)
+	return manifest, err
+}
+
+// RecoveryScript returns the bash script which replaces the darknode data with
+// the snapshot of given url. The snapshot is only used if its checksum matches
+// and there is enough disk space for it. It's extracted into a staging folder
+// first, and swapped in while the darknode is stopped. The old data is
+// restored if anything fails, and the darknode is started again either way.
+func RecoveryScript(snapshotURL, checksum string) string {
+	return fmt.Sprintf(`set -e
+dir="$HOME/.darknode"
+staging="$dir/snapshot-staging"
+backup="$dir/snapshot-backup"
+rm -rf "$staging" && mkdir -p "$staging/data"
+trap 'rm -rf "$staging"' EXIT
+
+available() {
+  echo $(($(df -Pk "$dir" | awk 'NR==2 {print $4}') * 1024))
+}
+
+# Make sure the snapshot fits on the disk before downloading it
+size=$(curl -sfSLI '%[1]v' | awk 'tolower($1) == "content-length:" {s=$2} END {print s+0}')
+if [ "$size" -eq 0 ]; then
+  echo "cannot get the size of the snapshot" >&2
+  exit 1
+fi
+if [ "$(available)" -lt "$size" ]; then
+  echo "not enough disk space to download the snapshot, need $size bytes" >&2
+  exit 1
+fi
+curl -sfSL '%[1]v' -o "$staging/snapshot.tar.gz"
+echo "%[2]v  $staging/snapshot.tar.gz" | sha256sum --check --status || {
+  echo "checksum of the snapshot doesn't match" >&2
+  exit 1
+}
+
+# Make sure the extracted snapshot fits as well
+size=$(tar tzvf "$staging/snapshot.tar.gz" | awk '{s+=$3} END {print s+0}')
+if [ "$(available)" -lt "$size" ]; then
+  echo "not enough disk space to extract the snapshot, need $size bytes" >&2
+  exit 1
+fi
+tar xzf "$staging/snapshot.tar.gz" -C "$staging/data"
+rm "$staging/snapshot.tar.gz"
+entries=$(ls -A "$staging/data")
+
+# Swap the data while the darknode is stopped, and restore the old data and
+# restart the darknode if anything fails
+restore() {
+  echo "recovery failed, restoring the old data" >&2
+  if [ -n "$backed_up" ]; then
+    for f in $entries; do
+      [ -e "$backup/$f" ] || rm -rf "$dir/$f"
+    done
+  fi
+  if [ -n "$prepared" ]; then
+    for f in $(ls -A "$backup"); do
+      rm -rf "$dir/$f" && mv "$backup/$f" "$dir/$f"
+    done
+    rm -rf "$backup"
+  fi
+  systemctl --user start darknode
+}
+trap 'restore' ERR
+systemctl --user stop darknode
+rm -rf "$backup"
+mkdir -p "$backup"
+prepared=1
+for f in db chain.wal genesis.json $entries; do
+  if [ -e "$dir/$f" ] && [ ! -e "$backup/$f" ]; then
+    mv "$dir/$f" "$backup/$f"
+  fi
+done
+backed_up=1
+for f in $entries; do
+  mv "$staging/data/$f" "$dir/$f"
+done
+trap - ERR
+rm -rf "$backup"
+systemctl --user start darknode`, snapshotURL, checksum)
+}
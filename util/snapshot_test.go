@@ -0,0 +1,216 @@
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/renproject/multichain"
+)
+
+// writeSnapshot writes a snapshot with the given files and returns its
+// checksum.
+func writeSnapshot(t *testing.T, path string, files map[string]string) string {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := FileChecksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checksum
+}
+
+func TestRecoveryScript(t *testing.T) {
+	for _, cmd := range []string{"bash", "curl", "sha256sum", "tar", "df"} {
+		if _, err := exec.LookPath(cmd); err != nil {
+			t.Skipf("%v is not available", cmd)
+		}
+	}
+	// The systemctl stub logs its arguments, and the mkdir stub fails to
+	// create the backup directory when asked to.
+	stubs := t.TempDir()
+	systemctl := "#!/bin/sh\necho \"$*\" >> \"$HOME/systemctl.log\"\n"
+	if err := ioutil.WriteFile(filepath.Join(stubs, "systemctl"), []byte(systemctl), 0700); err != nil {
+		t.Fatal(err)
+	}
+	mkdir, err := exec.LookPath("mkdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mkdirStub := fmt.Sprintf("#!/bin/sh\ncase \"$*\" in\n  *snapshot-backup*) [ -z \"$FAIL_BACKUP\" ] || exit 1 ;;\nesac\nexec %v \"$@\"\n", mkdir)
+	if err := ioutil.WriteFile(filepath.Join(stubs, "mkdir"), []byte(mkdirStub), 0700); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := filepath.Join(t.TempDir(), "latest.tar.gz")
+	checksum := writeSnapshot(t, snapshot, map[string]string{
+		"db/data":      "new-db",
+		"genesis.json": "new-genesis",
+	})
+	wrong := sha256.Sum256([]byte("something else"))
+
+	tests := []struct {
+		name       string
+		checksum   string
+		failBackup bool
+		success    bool
+		db         string
+		genesis    string
+	}{
+		{"checksum matches", checksum, false, true, "new-db", "new-genesis"},
+		{"checksum mismatch", hex.EncodeToString(wrong[:]), false, false, "old-db", "old-genesis"},
+		{"backup cannot be created", checksum, true, false, "old-db", "old-genesis"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home := t.TempDir()
+			dir := filepath.Join(home, ".darknode")
+			if err := os.MkdirAll(filepath.Join(dir, "db"), 0700); err != nil {
+				t.Fatal(err)
+			}
+			files := map[string]string{
+				"db/data":      "old-db",
+				"genesis.json": "old-genesis",
+				"config.json":  "config",
+			}
+			for name, content := range files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cmd := exec.Command("bash", "-c", RecoveryScript("file://"+snapshot, test.checksum))
+			cmd.Env = []string{"HOME=" + home, "PATH=" + stubs + ":" + os.Getenv("PATH")}
+			if test.failBackup {
+				cmd.Env = append(cmd.Env, "FAIL_BACKUP=1")
+			}
+			output, err := cmd.CombinedOutput()
+			if test.success && err != nil {
+				t.Fatalf("recovery failed, err = %v, output = %s", err, output)
+			}
+			if !test.success && err == nil {
+				t.Fatal("expected recovery to fail")
+			}
+
+			expected := map[string]string{
+				"db/data":      test.db,
+				"genesis.json": test.genesis,
+				"config.json":  "config",
+			}
+			for name, content := range expected {
+				data, err := ioutil.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != content {
+					t.Errorf("%v = %q, want %q", name, data, content)
+				}
+			}
+			for _, name := range []string{"snapshot-staging", "snapshot-backup"} {
+				if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+					t.Errorf("%v is left behind", name)
+				}
+			}
+
+			// The darknode must be running again if it has been stopped
+			calls, err := ioutil.ReadFile(filepath.Join(home, "systemctl.log"))
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(calls)), "\n")
+			if len(calls) > 0 && lines[len(lines)-1] != "--user start darknode" {
+				t.Errorf("darknode is not restarted, systemctl calls = %q", lines)
+			}
+			if test.failBackup && len(calls) == 0 {
+				t.Error("darknode is never stopped")
+			}
+		})
+	}
+}
+
+func TestSnapshotChecksum(t *testing.T) {
+	dir := t.TempDir()
+	folder := filepath.Join(dir, "testnet")
+	if err := os.MkdirAll(folder, 0700); err != nil {
+		t.Fatal(err)
+	}
+	source, err := ParseArtifactSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := filepath.Join(folder, LatestSnapshot)
+	checksum := writeSnapshot(t, snapshot, map[string]string{"db/data": "db"})
+	info, err := os.Stat(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer := sha256.Sum256([]byte("newer snapshot"))
+
+	tests := []struct {
+		name     string
+		sidecar  string
+		manifest string
+		valid    bool
+	}{
+		{"no manifest", checksum, "", true},
+		{"consistent manifest", checksum, fmt.Sprintf(`{"sha256":"%v","size":%v}`, checksum, info.Size()), true},
+		// The checksum and manifest of a new snapshot have been published, but
+		// latest.tar.gz hasn't been replaced yet
+		{"new snapshot being published", hex.EncodeToString(newer[:]), fmt.Sprintf(`{"sha256":"%x","size":%v}`, newer, info.Size()+1), false},
+		{"checksum mismatch", hex.EncodeToString(newer[:]), "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sidecar := fmt.Sprintf("%v  %v\n", test.sidecar, LatestSnapshot)
+			if err := ioutil.WriteFile(ChecksumName(snapshot), []byte(sidecar), 0600); err != nil {
+				t.Fatal(err)
+			}
+			os.Remove(ManifestName(snapshot))
+			if test.manifest != "" {
+				if err := ioutil.WriteFile(ManifestName(snapshot), []byte(test.manifest), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := SnapshotChecksum(source, multichain.NetworkTestnet, "", "")
+			if !test.valid {
+				if err == nil {
+					t.Fatalf("expected error, got checksum %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.sidecar {
+				t.Errorf("checksum = %v, want %v", got, test.sidecar)
+			}
+		})
+	}
+}
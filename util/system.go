@@ -1,6 +1,7 @@
 package util
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -31,15 +32,25 @@ func NodeConfigPath(name string) string {
 }
 
 // BackUpConfig copies the config file of the node to the backup folder under
-// .darknode directory in case something unexpected happens.
+// .darknode directory in case something unexpected happens. Encrypted config
+// is backed up as it is.
 func BackUpConfig(name string) error {
 	path := NodePath(name)
 	backupFolder := filepath.Join(Directory, "backup", name)
-	if err := Run("mkdir", "-p", backupFolder); err != nil {
+	if err := Run("mkdir", "-p", "-m", "0700", backupFolder); err != nil {
 		return err
 	}
-	backup := fmt.Sprintf("cp %v %v", filepath.Join(path, "config.json"), backupFolder)
-	return Run("bash", "-c", backup)
+	configPath := filepath.Join(path, "config.json")
+	if NodeConfigEncrypted(name) {
+		configPath = NodeEncryptedConfigPath(name)
+	}
+	backup := fmt.Sprintf("cp -p %v %v", configPath, backupFolder)
+	if err := Run("bash", "-c", backup); err != nil {
+		return err
+	}
+
+	// Configs of older darknodes might be readable by others
+	return os.Chmod(filepath.Join(backupFolder, filepath.Base(configPath)), 0600)
 }
 
 // run the command and pipe the output to the stdout
@@ -73,6 +84,7 @@ func RemoteRun(name, script, username string) error {
 	if err != nil {
 		return err
 	}
+	defer session.Close()
 
 	// Redirect the connect stdin, stdout and stderr to local.
 	sessStdIn, err := session.StdinPipe()
@@ -106,8 +118,80 @@ func RemoteOutput(name, script string) ([]byte, error) {
 	return session.Output(script)
 }
 
-// connect establishes a connection using SSH.
-func connect(name, user string) (*ssh.Session, error) {
+// RemoteStream runs the script on the instance which host the darknode of given
+// name and streams the output of the script to the given writers.
+func RemoteStream(name, script, username string, stdout, stderr io.Writer) error {
+	session, err := connect(name, username)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+	return session.Run(script)
+}
+
+// RemoteResult is the result of a script run on the instance.
+type RemoteResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// RemoteExec runs the script on the instance which host the darknode of given
+// name and collects its output. A non-zero exit code is not treated as an
+// error. The script is killed if it doesn't finish before the timeout, no
+// timeout is applied if it's zero.
+func RemoteExec(name, script, username string, timeout time.Duration) (RemoteResult, error) {
+	session, err := connect(name, username)
+	if err != nil {
+		return RemoteResult{}, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(script)
+	}()
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		timer = time.After(timeout)
+	}
+	select {
+	case err = <-done:
+	case <-timer:
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		<-done
+		return RemoteResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes(), ExitCode: -1}, fmt.Errorf("timeout after %v", timeout)
+	}
+
+	result := RemoteResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if err != nil {
+		exitErr, ok := err.(*ssh.ExitError)
+		if !ok {
+			result.ExitCode = -1
+			return result, err
+		}
+		result.ExitCode = exitErr.ExitStatus()
+	}
+	return result, nil
+}
+
+// ShellQuote quotes the string so it can be safely used as a single argument in
+// a shell script.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// Dial establishes a SSH connection to the instance which hosts the darknode of
+// given name. The caller is responsible for closing the client.
+func Dial(name, user string) (*ssh.Client, error) {
 	key, err := ParseSshPrivateKey(name)
 	if err != nil {
 		return nil, err
@@ -118,7 +202,7 @@ func connect(name, user string) (*ssh.Session, error) {
 			ssh.PublicKeys(key),
 		},
 		Timeout:         10 * time.Second,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: HostKeyCallback(name),
 	}
 
 	// Connect to the instance using ssh
@@ -126,12 +210,34 @@ func connect(name, user string) (*ssh.Session, error) {
 	if err != nil {
 		return nil, err
 	}
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%v:22", ip), &config)
+	return ssh.Dial("tcp", fmt.Sprintf("%v:22", ip), &config)
+}
+
+// remoteSession is a SSH session which owns the underlying client connection.
+type remoteSession struct {
+	*ssh.Session
+	client *ssh.Client
+}
+
+// Close closes both the session and the client connection.
+func (s remoteSession) Close() error {
+	s.Session.Close()
+	return s.client.Close()
+}
+
+// connect establishes a connection using SSH. The caller is responsible for
+// closing the returned session, which also closes the connection.
+func connect(name, user string) (remoteSession, error) {
+	client, err := Dial(name, user)
 	if err != nil {
-		return nil, err
+		return remoteSession{}, err
 	}
-
-	return client.NewSession()
+	sess, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return remoteSession{}, err
+	}
+	return remoteSession{Session: sess, client: client}, nil
 }
 
 // OpenInBrowser tries to open the url with system default browser. It ignores the error if failing.